@@ -10,11 +10,27 @@ import (
 )
 
 func usage() {
-	fmt.Fprintln(os.Stderr, "ergonomadic <run|genpasswd|initdb|upgradedb> [options]")
-	fmt.Fprintln(os.Stderr, "  run -conf <config>     -- run server")
-	fmt.Fprintln(os.Stderr, "  initdb -conf <config>  -- initialize database")
-	fmt.Fprintln(os.Stderr, "  upgrade -conf <config> -- upgrade database")
-	fmt.Fprintln(os.Stderr, "  genpasswd <password>   -- bcrypt a password")
+	fmt.Fprintln(os.Stderr, "ergonomadic <run|genpasswd|initdb|migrate|dbexport|dbimport|channel|account> [options]")
+	fmt.Fprintln(os.Stderr, "  run -conf <config>              -- run server")
+	fmt.Fprintln(os.Stderr, "  initdb [-force] -conf <config>  -- initialize database")
+	fmt.Fprintln(os.Stderr, "  migrate -conf <config>          -- apply database migrations")
+	fmt.Fprintln(os.Stderr, "  migrate status -conf <config>   -- show database migrations")
+	fmt.Fprintln(os.Stderr, "  dbexport -conf <config>         -- write database as JSON to stdout")
+	fmt.Fprintln(os.Stderr, "  dbimport [-merge] -conf <config> [file]")
+	fmt.Fprintln(os.Stderr, "                                  -- read JSON from file or stdin")
+	fmt.Fprintln(os.Stderr, "  channel list -conf <config>     -- list persistent channels")
+	fmt.Fprintln(os.Stderr, "  channel show -conf <config> <channel>")
+	fmt.Fprintln(os.Stderr, "                                  -- show a channel's modes and lists")
+	fmt.Fprintln(os.Stderr, "  channel set -conf <config> <channel> <modes> [args]")
+	fmt.Fprintln(os.Stderr, "                                  -- change a channel's modes")
+	fmt.Fprintln(os.Stderr, "  channel delete -conf <config> <channel>")
+	fmt.Fprintln(os.Stderr, "                                  -- delete a channel")
+	fmt.Fprintln(os.Stderr, "  account list -conf <config>     -- list accounts")
+	fmt.Fprintln(os.Stderr, "  account set -conf <config> <account> <password>")
+	fmt.Fprintln(os.Stderr, "                                  -- create an account or change its password")
+	fmt.Fprintln(os.Stderr, "  account delete -conf <config> <account>")
+	fmt.Fprintln(os.Stderr, "                                  -- delete an account")
+	fmt.Fprintln(os.Stderr, "  genpasswd <password>            -- bcrypt a password")
 	fmt.Fprintln(os.Stderr)
 	fmt.Fprintln(os.Stderr, "software version:", irc.SEM_VER)
 	flag.PrintDefaults()
@@ -25,6 +41,9 @@ func loadConfig(conf string) *irc.Config {
 	if err != nil {
 		log.Fatalln("error loading config:", err)
 	}
+	// before the database is opened, since it stores folded names
+	irc.SetCaseMapping(config.CaseMapping())
+	irc.SetLimits(config.Limits)
 
 	err = os.Chdir(filepath.Dir(conf))
 	if err != nil {
@@ -38,12 +57,23 @@ func genPasswd() {
 
 func main() {
 	var conf string
+	var force, merge bool
 	flag.Usage = usage
 
 	runFlags := flag.NewFlagSet("run", flag.ExitOnError)
 	runFlags.Usage = usage
 	runFlags.StringVar(&conf, "conf", "ergonomadic.conf", "ergonomadic config file")
 
+	initFlags := flag.NewFlagSet("initdb", flag.ExitOnError)
+	initFlags.Usage = usage
+	initFlags.StringVar(&conf, "conf", "ergonomadic.conf", "ergonomadic config file")
+	initFlags.BoolVar(&force, "force", false, "overwrite an existing database")
+
+	importFlags := flag.NewFlagSet("dbimport", flag.ExitOnError)
+	importFlags.Usage = usage
+	importFlags.StringVar(&conf, "conf", "ergonomadic.conf", "ergonomadic config file")
+	importFlags.BoolVar(&merge, "merge", false, "replace existing entries")
+
 	flag.Parse()
 
 	switch flag.Arg(0) {
@@ -55,22 +85,140 @@ func main() {
 		fmt.Println(encoded)
 
 	case "initdb":
-		runFlags.Parse(flag.Args()[1:])
+		initFlags.Parse(flag.Args()[1:])
 		config := loadConfig(conf)
-		irc.InitDB(config.Server.Database)
+		irc.InitDB(config.Server.Database, force)
 		log.Println("database initialized: ", config.Server.Database)
 
-	case "upgradedb":
+	case "migrate", "upgradedb":
+		args := flag.Args()[1:]
+		status := (len(args) > 0) && (args[0] == "status")
+		if status {
+			args = args[1:]
+		}
+		runFlags.Parse(args)
+		config := loadConfig(conf)
+
+		if status {
+			lines, err := irc.MigrationStatus(config.Server.Database)
+			if err != nil {
+				log.Fatalln("migrate error:", err)
+			}
+			for _, line := range lines {
+				fmt.Println(line)
+			}
+			return
+		}
+
+		db := irc.OpenDB(config.Server.Database)
+		defer db.Close()
+		if err := irc.MigrateDB(db); err != nil {
+			log.Fatalln("migrate error:", err)
+		}
+		log.Println("database migrated: ", config.Server.Database)
+
+	case "dbexport":
 		runFlags.Parse(flag.Args()[1:])
 		config := loadConfig(conf)
-		irc.UpgradeDB(config.Server.Database)
-		log.Println("database upgraded: ", config.Server.Database)
+		store := irc.OpenStore(config.Server.Database)
+		defer store.Close()
+		if err := irc.ExportDB(store, os.Stdout); err != nil {
+			log.Fatalln("dbexport error:", err)
+		}
+
+	case "dbimport":
+		importFlags.Parse(flag.Args()[1:])
+		// read the dump before loadConfig changes directory
+		in := os.Stdin
+		if importFlags.NArg() > 0 {
+			file, err := os.Open(importFlags.Arg(0))
+			if err != nil {
+				log.Fatalln("dbimport error:", err)
+			}
+			defer file.Close()
+			in = file
+		}
+		config := loadConfig(conf)
+		store := irc.OpenStore(config.Server.Database)
+		defer store.Close()
+		if err := irc.ImportDB(store, in, merge); err != nil {
+			log.Fatalln("dbimport error:", err)
+		}
+		log.Println("database imported: ", config.Server.Database)
+
+	case "channel":
+		if flag.NArg() < 2 {
+			usage()
+			os.Exit(2)
+		}
+		runFlags.Parse(flag.Args()[2:])
+		args := runFlags.Args()
+		config := loadConfig(conf)
+		store := irc.OpenStore(config.Server.Database)
+		defer store.Close()
+
+		var err error
+		switch subcommand := flag.Arg(1); {
+		case subcommand == "list":
+			err = irc.AdminListChannels(store, os.Stdout)
+
+		case len(args) == 0:
+			usage()
+			os.Exit(2)
+
+		case subcommand == "show":
+			err = irc.AdminShowChannel(store, irc.NewName(args[0]), os.Stdout)
+
+		case subcommand == "set":
+			err = irc.AdminSetChannel(store, irc.NewName(args[0]), args[1:])
+
+		case subcommand == "delete":
+			err = irc.AdminDeleteChannel(store, irc.NewName(args[0]))
+
+		default:
+			usage()
+			os.Exit(2)
+		}
+		if err != nil {
+			log.Fatalln("channel error:", err)
+		}
+
+	case "account":
+		if flag.NArg() < 2 {
+			usage()
+			os.Exit(2)
+		}
+		runFlags.Parse(flag.Args()[2:])
+		args := runFlags.Args()
+		config := loadConfig(conf)
+		store := irc.OpenStore(config.Server.Database)
+		defer store.Close()
+
+		var err error
+		switch subcommand := flag.Arg(1); {
+		case subcommand == "list":
+			err = irc.AdminListAccounts(store, os.Stdout)
+
+		case subcommand == "set" && len(args) == 2:
+			err = irc.AdminSetAccount(store, irc.NewName(args[0]), args[1])
+
+		case subcommand == "delete" && len(args) == 1:
+			err = irc.AdminDeleteAccount(store, irc.NewName(args[0]))
+
+		default:
+			usage()
+			os.Exit(2)
+		}
+		if err != nil {
+			log.Fatalln("account error:", err)
+		}
 
 	case "run":
 		runFlags.Parse(flag.Args()[1:])
 		config := loadConfig(conf)
 		irc.Log.SetLevel(config.Server.Log)
-		server := irc.NewServer(config)
+		server := irc.NewServer(config, irc.OpenStore(config.Server.Database))
+		server.Listen(config)
 		log.Println(irc.SEM_VER, "running")
 		defer log.Println(irc.SEM_VER, "exiting")
 		server.Run()
@@ -0,0 +1,76 @@
+package irc
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// The `ergonomadic account` subcommands manage the accounts clients LOGIN
+// to. Like the channel subcommands, they are meant for a stopped server.
+
+// AdminListAccounts prints each account and when it was created.
+func AdminListAccounts(store Store, out io.Writer) error {
+	records, err := store.Accounts()
+	if err != nil {
+		return err
+	}
+	sort.Sort(accountRecordsByName(records))
+	for _, record := range records {
+		fmt.Fprintf(out, "%s %s\n", record.name,
+			record.ctime.UTC().Format(time.RFC3339))
+	}
+	return nil
+}
+
+// AdminSetAccount creates an account or changes its password.
+func AdminSetAccount(store Store, name Name, password string) error {
+	if !name.IsNickname() {
+		return fmt.Errorf("invalid account name: %s", name)
+	}
+	if password == "" {
+		return EmptyPasswordError
+	}
+	record, err := store.Account(name)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		record = &AccountRecord{
+			ctime: time.Now(),
+			name:  name,
+		}
+	}
+	record.passwordHash, err = GenerateHash(password)
+	if err != nil {
+		return err
+	}
+	return store.SaveAccount(record)
+}
+
+// AdminDeleteAccount removes an account.
+func AdminDeleteAccount(store Store, name Name) error {
+	record, err := store.Account(name)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return fmt.Errorf("no such account: %s", name)
+	}
+	return store.DeleteAccount(record.name)
+}
+
+type accountRecordsByName []*AccountRecord
+
+func (records accountRecordsByName) Len() int {
+	return len(records)
+}
+
+func (records accountRecordsByName) Less(i, j int) bool {
+	return records[i].name < records[j].name
+}
+
+func (records accountRecordsByName) Swap(i, j int) {
+	records[i], records[j] = records[j], records[i]
+}
@@ -0,0 +1,86 @@
+package irc
+
+import (
+	"fmt"
+	"strings"
+)
+
+// CaseMapping decides which nicks, channel names and masks are equal.
+// There is one for the whole server, set from the config before anything
+// is compared.
+type CaseMapping string
+
+const (
+	// only A-Z are folded
+	CaseMappingASCII CaseMapping = "ascii"
+	// A-Z are folded, and so are []\~ to {}|^
+	CaseMappingRFC1459 CaseMapping = "rfc1459"
+	// the PRECIS UsernameCaseMapped profile, see precis.go
+	CaseMappingRFC7613 CaseMapping = "rfc7613"
+
+	DEFAULT_CASEMAPPING = CaseMappingRFC7613
+)
+
+var (
+	casemapping = DEFAULT_CASEMAPPING
+
+	rfc1459Folder = strings.NewReplacer("[", "{", "]", "}", "\\", "|", "~", "^")
+)
+
+// ParseCaseMapping accepts the names advertised in ISUPPORT CASEMAPPING.
+// An empty name is the default.
+func ParseCaseMapping(name string) (CaseMapping, error) {
+	switch mapping := CaseMapping(strings.ToLower(name)); mapping {
+	case "":
+		return DEFAULT_CASEMAPPING, nil
+	case CaseMappingASCII, CaseMappingRFC1459, CaseMappingRFC7613:
+		return mapping, nil
+	}
+	return "", fmt.Errorf("unknown casemapping: %s", name)
+}
+
+// SetCaseMapping changes how every Name is folded. Anything keyed by a
+// folded name, in memory or in the database, must be rebuilt afterwards.
+func SetCaseMapping(mapping CaseMapping) {
+	casemapping = mapping
+}
+
+// CurrentCaseMapping is the casemapping set by SetCaseMapping.
+func CurrentCaseMapping() CaseMapping {
+	return casemapping
+}
+
+func (mapping CaseMapping) String() string {
+	return string(mapping)
+}
+
+// Fold returns the form of `str` that compares equal to all its other
+// cases.
+func (mapping CaseMapping) Fold(str string) string {
+	switch mapping {
+	case CaseMappingASCII:
+		return foldASCII(str)
+	case CaseMappingRFC1459:
+		return rfc1459Folder.Replace(foldASCII(str))
+	}
+	return foldPRECIS(str)
+}
+
+// Allows is false for nicks that the casemapping can't compare safely.
+// Only rfc7613 refuses any.
+func (mapping CaseMapping) Allows(nick string) bool {
+	if mapping == CaseMappingRFC7613 {
+		return allowsPRECIS(nick)
+	}
+	return true
+}
+
+func foldASCII(str string) string {
+	bytes := []byte(str)
+	for index, b := range bytes {
+		if ('A' <= b) && (b <= 'Z') {
+			bytes[index] = b + ('a' - 'A')
+		}
+	}
+	return string(bytes)
+}
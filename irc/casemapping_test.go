@@ -0,0 +1,92 @@
+package irc
+
+import (
+	"testing"
+)
+
+func TestCaseMappingFold(t *testing.T) {
+	tests := []struct {
+		mapping CaseMapping
+		str     string
+		folded  string
+	}{
+		{CaseMappingASCII, "Dan[]\\~", "dan[]\\~"},
+		{CaseMappingASCII, "DÄN", "dÄn"},
+		{CaseMappingRFC1459, "Dan[]\\~", "dan{}|^"},
+		{CaseMappingRFC1459, "DÄN", "dÄn"},
+		{CaseMappingRFC7613, "Dan[]\\~", "dan[]\\~"},
+		{CaseMappingRFC7613, "DÄN", "dän"},
+		{CaseMappingRFC7613, "ΣΑΣ", "σασ"},
+		// width mapping comes before lowercasing
+		{CaseMappingRFC7613, "ＤＡＮ", "dan"},
+		{CaseMappingRFC7613, "ｶﾞ", "ガ"},
+		{CaseMappingRFC7613, "a　b", "a b"},
+		// decomposed input is composed
+		{CaseMappingRFC7613, "DÄN", "dän"},
+		{CaseMappingRFC7613, "", ""},
+	}
+	for _, test := range tests {
+		if folded := test.mapping.Fold(test.str); folded != test.folded {
+			t.Errorf("%s.Fold(%q) = %q, want %q",
+				test.mapping, test.str, folded, test.folded)
+		}
+	}
+}
+
+func TestParseCaseMapping(t *testing.T) {
+	tests := []struct {
+		name    string
+		mapping CaseMapping
+		valid   bool
+	}{
+		{"", DEFAULT_CASEMAPPING, true},
+		{"ascii", CaseMappingASCII, true},
+		{"RFC1459", CaseMappingRFC1459, true},
+		{"rfc7613", CaseMappingRFC7613, true},
+		{"strict-rfc1459", "", false},
+	}
+	for _, test := range tests {
+		mapping, err := ParseCaseMapping(test.name)
+		if (err == nil) != test.valid || (mapping != test.mapping) {
+			t.Errorf("ParseCaseMapping(%q) = %q, %v", test.name, mapping, err)
+		}
+	}
+}
+
+func TestCaseMappingAllows(t *testing.T) {
+	tests := []struct {
+		nick  string
+		allow bool
+	}{
+		{"dan", true},
+		{"[dan]_", true},
+		{"dän", true},
+		{"даниил", true},
+		{"小丹", true},
+		{"", false},
+		{"dan☃", false},               // symbols
+		{"dan\u200d", false},          // ZERO WIDTH JOINER is contextual
+		{"dan\u0640", false},          // ARABIC TATWEEL is an exception
+		{"\u1100\u1161", false},       // conjoining jamo
+		{"\uff44\uff41\uff4e", false}, // fullwidth forms are mapped, not allowed
+		{"dan²", false},               // compatibility forms
+		// the Bidi Rule, for nicks with right-to-left characters
+		{"דן", true},
+		{"דן1", true},
+		{"1דן", false},
+		{"dדן", false},
+		{"דןd", false},
+		{"דן-", false},
+		{"سلام١٢", true},
+		{"سلام١" + "1", false},
+		{"\u05d3\u05b8", true}, // ending with a mark
+	}
+	for _, test := range tests {
+		if allow := CaseMappingRFC7613.Allows(test.nick); allow != test.allow {
+			t.Errorf("Allows(%q) = %t, want %t", test.nick, allow, test.allow)
+		}
+		if !CaseMappingRFC1459.Allows(test.nick) {
+			t.Errorf("rfc1459 refused %q", test.nick)
+		}
+	}
+}
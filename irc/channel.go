@@ -1,37 +1,52 @@
 package irc
 
 import (
-	"log"
 	"strconv"
+	"time"
+)
+
+const (
+	INVITE_TIMEOUT      = time.Hour       // how long an invite stays in the +I list
+	KNOCK_CHANNEL_DELAY = time.Minute     // between knocks on one channel
+	KNOCK_CLIENT_DELAY  = 5 * time.Minute // between knocks by one client
 )
 
 type Channel struct {
-	flags     ChannelModeSet
-	lists     map[ChannelMode]*UserMaskSet
-	key       Text
-	members   MemberSet
-	name      Name
-	server    *Server
-	topic     Text
-	userLimit uint64
+	ctime         time.Time
+	flags         ChannelModeSet
+	forward       Name
+	joinThrottle  *Throttle
+	knockThrottle *Throttle
+	lists         map[ChannelMode]*UserMaskSet
+	key           Text
+	members       MemberSet
+	name          Name
+	server        *Server
+	topic         Text
+	topicSetBy    Name
+	topicTime     time.Time
+	userLimit     uint64
 }
 
 // NewChannel creates a new channel from a `Server` and a `name`
 // string, which must be unique on the server.
 func NewChannel(s *Server, name Name) *Channel {
 	channel := &Channel{
+		ctime: time.Now(),
 		flags: make(ChannelModeSet),
 		lists: map[ChannelMode]*UserMaskSet{
 			BanMask:    NewUserMaskSet(),
 			ExceptMask: NewUserMaskSet(),
 			InviteMask: NewUserMaskSet(),
+			QuietMask:  NewUserMaskSet(),
 		},
-		members: make(MemberSet),
-		name:    name,
-		server:  s,
+		knockThrottle: NewThrottle(1, KNOCK_CHANNEL_DELAY),
+		members:       make(MemberSet),
+		name:          name,
+		server:        s,
 	}
 
-	s.channels.Add(channel)
+	s.addChannel(channel)
 
 	return channel
 }
@@ -41,12 +56,44 @@ func (channel *Channel) IsEmpty() bool {
 }
 
 func (channel *Channel) Names(client *Client) {
-	client.RplNamReply(channel)
+	if channel.IsVisibleTo(client) {
+		client.RplNamReply(channel)
+	}
 	client.RplEndOfNames(channel)
 }
 
+// NamesType is the RPL_NAMREPLY channel type: "@" for secret, "*" for
+// private and "=" for public channels.
+func (channel *Channel) NamesType() string {
+	switch {
+	case channel.flags[Secret]:
+		return "@"
+	case channel.flags[Private]:
+		return "*"
+	}
+	return "="
+}
+
 func (channel *Channel) ClientIsOperator(client *Client) bool {
-	return client.flags[Operator] || channel.members.HasMode(client, ChannelOperator)
+	return channel.ClientHasRank(client, ChannelOperator)
+}
+
+// ClientHasRank is true for IRC operators and members with `mode` or a
+// higher-ranked membership mode.
+func (channel *Channel) ClientHasRank(client *Client, mode ChannelMode) bool {
+	return client.flags[Operator] || (channel.members.Rank(client) >= mode.Rank())
+}
+
+// ClientCanActOn is true if `client` outranks `target` in the channel. Ops
+// may also act on other ops, as they always could.
+func (channel *Channel) ClientCanActOn(client *Client, target *Client) bool {
+	if client.flags[Operator] {
+		return true
+	}
+	rank := channel.members.Rank(client)
+	targetRank := channel.members.Rank(target)
+	return (rank > targetRank) ||
+		((rank == ChannelOperator.Rank()) && (targetRank == rank))
 }
 
 func (channel *Channel) Nicks(target *Client) []string {
@@ -54,26 +101,30 @@ func (channel *Channel) Nicks(target *Client) []string {
 	nicks := make([]string, len(channel.members))
 	i := 0
 	for client, modes := range channel.members {
-		if isMultiPrefix {
-			if modes[ChannelOperator] {
-				nicks[i] += "@"
-			}
-			if modes[Voice] {
-				nicks[i] += "+"
-			}
-		} else {
-			if modes[ChannelOperator] {
-				nicks[i] += "@"
-			} else if modes[Voice] {
-				nicks[i] += "+"
-			}
-		}
-		nicks[i] += client.Nick().String()
+		nicks[i] = modes.Prefixes(isMultiPrefix) + client.Nick().String()
 		i += 1
 	}
 	return nicks
 }
 
+// IsHidden is true if a mode like +s hides the channel from non-members.
+func (channel *Channel) IsHidden() bool {
+	for mode := range channel.flags {
+		if spec := LookupChannelMode(mode); (spec != nil) && spec.hidesChannel {
+			return true
+		}
+	}
+	return false
+}
+
+// IsVisibleTo reports whether a hidden channel may be shown to `client`.
+func (channel *Channel) IsVisibleTo(client *Client) bool {
+	if !channel.IsHidden() {
+		return true
+	}
+	return client.flags[Operator] || channel.members.Has(client)
+}
+
 func (channel *Channel) Id() Name {
 	return channel.name
 }
@@ -89,15 +140,19 @@ func (channel *Channel) String() string {
 // <mode> <mode params>
 func (channel *Channel) ModeString(client *Client) (str string) {
 	isMember := client.flags[Operator] || channel.members.Has(client)
-	showKey := isMember && (channel.key != "")
-	showUserLimit := channel.userLimit > 0
+	args := make([]string, 0)
 
-	// flags with args
-	if showKey {
-		str += Key.String()
-	}
-	if showUserLimit {
-		str += UserLimit.String()
+	// flags with args, in registry order to keep positional arguments in
+	// place
+	for _, mode := range SupportedChannelModes {
+		spec := LookupChannelMode(mode)
+		if (spec.param == nil) || (spec.membersOnly && !isMember) {
+			continue
+		}
+		if arg := spec.param(channel); arg != "" {
+			str += mode.String()
+			args = append(args, arg)
+		}
 	}
 
 	// flags
@@ -109,13 +164,8 @@ func (channel *Channel) ModeString(client *Client) (str string) {
 		str = "+" + str
 	}
 
-	// args for flags with args: The order must match above to keep
-	// positional arguments in place.
-	if showKey {
-		str += " " + channel.key.String()
-	}
-	if showUserLimit {
-		str += " " + strconv.FormatUint(channel.userLimit, 10)
+	for _, arg := range args {
+		str += " " + arg
 	}
 
 	return
@@ -131,36 +181,38 @@ func (channel *Channel) CheckKey(key Text) bool {
 }
 
 func (channel *Channel) Join(client *Client, key Text) {
+	channel.join(client, key, true)
+}
+
+// join only follows the +f forward when `forward` is set, so that forwards
+// are never chained.
+func (channel *Channel) join(client *Client, key Text, forward bool) {
 	if channel.members.Has(client) {
 		// already joined, no message?
 		return
 	}
 
-	if channel.IsFull() {
-		client.ErrChannelIsFull(channel)
-		return
-	}
+	now := time.Now()
+	switch code := channel.checkJoin(client, key, now); code {
+	case 0:
+		// allowed
 
-	if !channel.CheckKey(key) {
-		client.ErrBadChannelKey(channel)
-		return
-	}
-
-	isInvited := channel.lists[InviteMask].Match(client.UserHost())
-	if channel.flags[InviteOnly] && !isInvited {
-		client.ErrInviteOnlyChan(channel)
+	case ERR_CHANNELISFULL, ERR_INVITEONLYCHAN, ERR_THROTTLE:
+		if !(forward && channel.Forward(client, now)) {
+			client.ErrCannotJoin(channel, code)
+		}
 		return
-	}
 
-	if channel.lists[BanMask].Match(client.UserHost()) &&
-		!isInvited &&
-		!channel.lists[ExceptMask].Match(client.UserHost()) {
-		client.ErrBannedFromChan(channel)
+	default:
+		client.ErrCannotJoin(channel, code)
 		return
 	}
 
 	client.channels.Add(channel)
 	channel.members.Add(client)
+	if channel.joinThrottle != nil {
+		channel.joinThrottle.Record(now)
+	}
 	if !channel.flags[Persistent] && (len(channel.members) == 1) {
 		channel.members[client][ChannelCreator] = true
 		channel.members[client][ChannelOperator] = true
@@ -174,6 +226,62 @@ func (channel *Channel) Join(client *Client, key Text) {
 	channel.Names(client)
 }
 
+// checkJoin returns the error numeric that stops `client` joining, or 0 if
+// it may join.
+func (channel *Channel) checkJoin(client *Client, key Text,
+	now time.Time) NumericCode {
+	if channel.IsFull() {
+		return ERR_CHANNELISFULL
+	}
+
+	if !channel.CheckKey(key) {
+		return ERR_BADCHANNELKEY
+	}
+
+	if channel.flags[TLSOnly] && !client.IsSecure() {
+		return ERR_SECUREONLYCHAN
+	}
+
+	if channel.flags[RegisteredOnly] && (client.account == "") {
+		return ERR_NEEDREGGEDNICK
+	}
+
+	isInvited := channel.lists[InviteMask].Match(client)
+	if channel.flags[InviteOnly] && !isInvited {
+		return ERR_INVITEONLYCHAN
+	}
+
+	if (channel.joinThrottle != nil) && !isInvited &&
+		!channel.joinThrottle.Allow(now) {
+		return ERR_THROTTLE
+	}
+
+	if channel.IsBanned(client) && !isInvited {
+		return ERR_BANNEDFROMCHAN
+	}
+
+	return 0
+}
+
+// Forward sends `client` to the +f channel instead, if it exists and would
+// let `client` in. It is false if there was nowhere to go.
+func (channel *Channel) Forward(client *Client, now time.Time) bool {
+	if channel.forward == "" {
+		return false
+	}
+	target := channel.server.channels.Get(channel.forward)
+	if (target == nil) || (target == channel) || target.members.Has(client) {
+		return false
+	}
+	if target.checkJoin(client, "", now) != 0 {
+		return false
+	}
+
+	client.ErrLinkChannel(channel, target)
+	target.join(client, "", false)
+	return true
+}
+
 func (channel *Channel) Part(client *Client, message Text) {
 	if !channel.members.Has(client) {
 		client.ErrNotOnChannel(channel)
@@ -200,6 +308,9 @@ func (channel *Channel) GetTopic(client *Client) {
 	}
 
 	client.RplTopic(channel)
+	if channel.topicSetBy != "" {
+		client.RplTopicWhoTime(channel)
+	}
 }
 
 func (channel *Channel) SetTopic(client *Client, topic Text) {
@@ -208,219 +319,395 @@ func (channel *Channel) SetTopic(client *Client, topic Text) {
 		return
 	}
 
-	if channel.flags[OpOnlyTopic] && !channel.ClientIsOperator(client) {
+	if channel.flags[OpOnlyTopic] && !channel.ClientHasRank(client, HalfOperator) {
 		client.ErrChanOPrivIsNeeded(channel)
 		return
 	}
 
+	if channel.IsQuieted(client) {
+		client.ErrCannotSendToChan(channel)
+		return
+	}
+
 	channel.topic = topic
+	channel.topicSetBy = client.UserHost()
+	channel.topicTime = time.Now()
 
 	reply := RplTopicMsg(client, channel)
 	for member := range channel.members {
 		member.Reply(reply)
 	}
 
-	if err := channel.Persist(); err != nil {
-		log.Println("Channel.Persist:", channel, err)
-	}
+	channel.Persist()
 }
 
-func (channel *Channel) CanSpeak(client *Client) bool {
+func (channel *Channel) CanSpeak(client *Client, message Text) bool {
 	if client.flags[Operator] {
 		return true
 	}
+	if channel.flags[NoColor] && message.HasColors() {
+		return false
+	}
+	if channel.flags[NoCTCP] && message.IsCTCP(true) {
+		return false
+	}
 	if channel.flags[NoOutside] && !channel.members.Has(client) {
 		return false
 	}
-	if channel.flags[Moderated] && !(channel.members.HasMode(client, Voice) ||
-		channel.members.HasMode(client, ChannelOperator)) {
+	if channel.flags[Moderated] && !channel.ClientHasRank(client, Voice) {
+		return false
+	}
+	if channel.flags[RegisteredSpeak] && (client.account == "") &&
+		!channel.ClientHasRank(client, Voice) {
+		return false
+	}
+	if channel.IsQuieted(client) {
 		return false
 	}
 	return true
 }
 
+// IsBanned is true for clients matching the ban list who aren't exempt
+// through the exception list.
+func (channel *Channel) IsBanned(client *Client) bool {
+	return channel.lists[BanMask].Match(client) &&
+		!channel.lists[ExceptMask].Match(client)
+}
+
+// IsQuieted is true for members matching the quiet list who aren't exempt
+// through the exception list or a membership mode.
+func (channel *Channel) IsQuieted(client *Client) bool {
+	if channel.ClientHasRank(client, Voice) {
+		return false
+	}
+	return channel.lists[QuietMask].Match(client) &&
+		!channel.lists[ExceptMask].Match(client)
+}
+
 func (channel *Channel) PrivMsg(client *Client, message Text) {
-	if !channel.CanSpeak(client) {
+	if !channel.CanSpeak(client, message) {
 		client.ErrCannotSendToChan(channel)
 		return
 	}
-	reply := RplPrivMsg(client, channel, message)
+	replies := RplPrivMsgs(client, channel, message)
 	for member := range channel.members {
 		if member == client {
 			continue
 		}
-		member.Reply(reply)
+		for _, reply := range replies {
+			member.Reply(reply)
+		}
 	}
 }
 
-func (channel *Channel) applyModeFlag(client *Client, mode ChannelMode,
-	op ModeOp) bool {
+func (channel *Channel) applyModeFlag(client *Client,
+	change *ChannelModeChange) (bool, *ChannelModeError) {
 	if !channel.ClientIsOperator(client) {
-		client.ErrChanOPrivIsNeeded(channel)
-		return false
+		return false, NewChannelModeError(ERR_CHANOPRIVSNEEDED, channel.name)
 	}
 
-	switch op {
+	mode := change.mode
+	switch change.op {
 	case Add:
 		if channel.flags[mode] {
-			return false
+			return false, nil
 		}
 		channel.flags[mode] = true
-		return true
+		return true, nil
 
 	case Remove:
 		if !channel.flags[mode] {
-			return false
+			return false, nil
 		}
 		delete(channel.flags, mode)
-		return true
+		return true, nil
 	}
-	return false
+	return false, nil
 }
 
-func (channel *Channel) applyModeMember(client *Client, mode ChannelMode,
-	op ModeOp, nick Name) bool {
-	if !channel.ClientIsOperator(client) {
-		client.ErrChanOPrivIsNeeded(channel)
-		return false
+// memberModeRank is the rank needed to grant or take away a membership
+// mode.
+func memberModeRank(mode ChannelMode) ChannelMode {
+	switch mode {
+	case ChannelOwner, ChannelAdmin:
+		return ChannelOwner
+
+	case ChannelOperator, HalfOperator:
+		return ChannelOperator
 	}
+	return HalfOperator
+}
 
+func (channel *Channel) applyModeMember(client *Client,
+	change *ChannelModeChange) (bool, *ChannelModeError) {
+	mode, op, nick := change.mode, change.op, NewName(change.arg)
 	if nick == "" {
-		client.ErrNeedMoreParams("MODE")
-		return false
+		return false, NewChannelModeError(ERR_NEEDMOREPARAMS, "")
 	}
 
 	target := channel.server.clients.Get(nick)
 	if target == nil {
-		client.ErrNoSuchNick(nick)
-		return false
+		return false, NewChannelModeError(ERR_NOSUCHNICK, nick)
 	}
 
 	if !channel.members.Has(target) {
-		client.ErrUserNotInChannel(channel, target)
-		return false
+		return false, NewChannelModeError(ERR_USERNOTINCHANNEL, target.Nick())
+	}
+
+	// Anyone may give up their own membership modes.
+	isSelfRemove := (op == Remove) && (target == client)
+	if !isSelfRemove && !(channel.ClientHasRank(client, memberModeRank(mode)) &&
+		((target == client) || channel.ClientCanActOn(client, target))) {
+		return false, NewChannelModeError(ERR_CHANOPRIVSNEEDED, channel.name)
 	}
 
 	switch op {
 	case Add:
 		if channel.members[target][mode] {
-			return false
+			return false, nil
 		}
 		channel.members[target][mode] = true
-		return true
+		return true, nil
 
 	case Remove:
 		if !channel.members[target][mode] {
-			return false
+			return false, nil
 		}
-		channel.members[target][mode] = false
-		return true
+		delete(channel.members[target], mode)
+		return true, nil
 	}
-	return false
+	return false, nil
 }
 
 func (channel *Channel) ShowMaskList(client *Client, mode ChannelMode) {
-	for lmask := range channel.lists[mode].masks {
+	for _, lmask := range channel.lists[mode].masks {
 		client.RplMaskList(mode, channel, lmask)
 	}
 	client.RplEndOfMaskList(mode, channel)
 }
 
-func (channel *Channel) applyModeMask(client *Client, mode ChannelMode, op ModeOp,
-	mask Name) bool {
+func (channel *Channel) applyModeMask(client *Client,
+	change *ChannelModeChange) (bool, *ChannelModeError) {
+	mode, op, mask := change.mode, change.op, NewName(change.arg)
 	list := channel.lists[mode]
 	if list == nil {
 		// This should never happen, but better safe than panicky.
-		return false
+		return false, nil
 	}
 
 	if (op == List) || (mask == "") {
 		channel.ShowMaskList(client, mode)
-		return false
+		return false, nil
 	}
 
-	if !channel.ClientIsOperator(client) {
-		client.ErrChanOPrivIsNeeded(channel)
-		return false
+	if !channel.ClientHasRank(client, HalfOperator) {
+		return false, NewChannelModeError(ERR_CHANOPRIVSNEEDED, channel.name)
 	}
 
 	if op == Add {
-		return list.Add(mask)
+		if IsExtBan(mask) && (ParseExtBan(mask) == nil) {
+			return false, NewChannelModeError(ERR_BADMASK, mask)
+		}
+		return list.Add(mask, client.UserHost(), time.Time{}), nil
 	}
 
 	if op == Remove {
-		return list.Remove(mask)
+		return list.Remove(mask), nil
 	}
 
-	return false
+	return false, nil
 }
 
-func (channel *Channel) applyMode(client *Client, change *ChannelModeChange) bool {
-	switch change.mode {
-	case BanMask, ExceptMask, InviteMask:
-		return channel.applyModeMask(client, change.mode, change.op,
-			NewName(change.arg))
+// TimedBan adds a ban that is removed again after `duration`.
+func (channel *Channel) TimedBan(client *Client, mask Name, duration time.Duration) {
+	if !channel.ClientHasRank(client, HalfOperator) {
+		client.ErrChanOPrivIsNeeded(channel)
+		return
+	}
 
-	case InviteOnly, Moderated, NoOutside, OpOnlyTopic, Persistent, Private:
-		return channel.applyModeFlag(client, change.mode, change.op)
+	if IsExtBan(mask) {
+		if ParseExtBan(mask) == nil {
+			client.ErrBadMask(mask)
+			return
+		}
+	} else {
+		mask = ExpandUserHost(mask)
+	}
 
-	case Key:
-		if !channel.ClientIsOperator(client) {
-			client.ErrChanOPrivIsNeeded(channel)
-			return false
+	if !channel.lists[BanMask].Add(mask, client.UserHost(), time.Now().Add(duration)) {
+		return
+	}
+
+	reply := RplChannelMode(client, channel, ChannelModeChanges{&ChannelModeChange{
+		mode: BanMask,
+		op:   Add,
+		arg:  mask.String(),
+	}})
+	for member := range channel.members {
+		member.Reply(reply)
+	}
+
+	channel.Persist()
+}
+
+// Expire removes expired masks from every list and tells members.
+func (channel *Channel) Expire(now time.Time) {
+	changes := make(ChannelModeChanges, 0)
+	for mode, list := range channel.lists {
+		for _, mask := range list.Expire(now) {
+			changes = append(changes, &ChannelModeChange{
+				mode: mode,
+				op:   Remove,
+				arg:  mask.String(),
+			})
 		}
+	}
+	if len(changes) == 0 {
+		return
+	}
 
-		switch change.op {
-		case Add:
-			if change.arg == "" {
-				client.ErrNeedMoreParams("MODE")
-				return false
-			}
-			key := NewText(change.arg)
-			if key == channel.key {
-				return false
-			}
-
-			channel.key = key
-			return true
+	reply := RplChannelMode(channel.server, channel, changes)
+	for member := range channel.members {
+		member.Reply(reply)
+	}
 
-		case Remove:
-			channel.key = ""
-			return true
+	channel.Persist()
+}
+
+func (channel *Channel) applyModeKey(client *Client,
+	change *ChannelModeChange) (bool, *ChannelModeError) {
+	if !channel.ClientIsOperator(client) {
+		return false, NewChannelModeError(ERR_CHANOPRIVSNEEDED, channel.name)
+	}
+
+	switch change.op {
+	case Add:
+		if change.arg == "" {
+			return false, NewChannelModeError(ERR_NEEDMOREPARAMS, "")
 		}
+		key := NewText(change.arg)
+		if key == channel.key {
+			return false, nil
+		}
+
+		channel.key = key
+		return true, nil
 
-	case UserLimit:
+	case Remove:
+		channel.key = ""
+		return true, nil
+	}
+	return false, nil
+}
+
+func (channel *Channel) applyModeUserLimit(client *Client,
+	change *ChannelModeChange) (bool, *ChannelModeError) {
+	if !channel.ClientIsOperator(client) {
+		return false, NewChannelModeError(ERR_CHANOPRIVSNEEDED, channel.name)
+	}
+
+	switch change.op {
+	case Add:
 		limit, err := strconv.ParseUint(change.arg, 10, 64)
 		if err != nil {
-			client.ErrNeedMoreParams("MODE")
-			return false
+			return false, NewChannelModeError(ERR_NEEDMOREPARAMS, "")
 		}
 		if (limit == 0) || (limit == channel.userLimit) {
-			return false
+			return false, nil
 		}
 
 		channel.userLimit = limit
-		return true
+		return true, nil
 
-	case ChannelOperator, Voice:
-		return channel.applyModeMember(client, change.mode, change.op,
-			NewName(change.arg))
+	case Remove:
+		if channel.userLimit == 0 {
+			return false, nil
+		}
+		channel.userLimit = 0
+		return true, nil
+	}
+	return false, nil
+}
 
-	default:
-		client.ErrUnknownMode(change.mode, channel)
+func (channel *Channel) applyModeJoinThrottle(client *Client,
+	change *ChannelModeChange) (bool, *ChannelModeError) {
+	if !channel.ClientIsOperator(client) {
+		return false, NewChannelModeError(ERR_CHANOPRIVSNEEDED, channel.name)
 	}
-	return false
+
+	switch change.op {
+	case Add:
+		throttle, err := ParseThrottle(change.arg)
+		if err != nil {
+			return false, NewChannelModeError(ERR_NEEDMOREPARAMS, "")
+		}
+		change.arg = throttle.String()
+		channel.joinThrottle = throttle
+		return true, nil
+
+	case Remove:
+		if channel.joinThrottle == nil {
+			return false, nil
+		}
+		channel.joinThrottle = nil
+		return true, nil
+	}
+	return false, nil
+}
+
+func (channel *Channel) applyModeForward(client *Client,
+	change *ChannelModeChange) (bool, *ChannelModeError) {
+	if !channel.ClientIsOperator(client) {
+		return false, NewChannelModeError(ERR_CHANOPRIVSNEEDED, channel.name)
+	}
+
+	switch change.op {
+	case Add:
+		forward := NewName(change.arg)
+		if !forward.IsChannel() {
+			return false, NewChannelModeError(ERR_NOSUCHCHANNEL, forward)
+		}
+		if (forward.ToLower() == channel.name.ToLower()) ||
+			(forward == channel.forward) {
+			return false, nil
+		}
+		channel.forward = forward
+		return true, nil
+
+	case Remove:
+		if channel.forward == "" {
+			return false, nil
+		}
+		channel.forward = ""
+		return true, nil
+	}
+	return false, nil
+}
+
+func (channel *Channel) applyMode(client *Client,
+	change *ChannelModeChange) (bool, *ChannelModeError) {
+	spec := LookupChannelMode(change.mode)
+	if spec == nil {
+		return false, NewChannelModeError(ERR_UNKNOWNMODE, Name(change.mode.String()))
+	}
+	return spec.apply(channel, client, change)
 }
 
 func (channel *Channel) Mode(client *Client, changes ChannelModeChanges) {
 	if len(changes) == 0 {
 		client.RplChannelModeIs(channel)
+		client.RplCreationTime(channel)
 		return
 	}
 
 	applied := make(ChannelModeChanges, 0)
 	for _, change := range changes {
-		if channel.applyMode(client, change) {
+		ok, err := channel.applyMode(client, change)
+		if err != nil {
+			client.ErrChannelMode(channel, err)
+			continue
+		}
+		if ok {
 			applied = append(applied, change)
 		}
 	}
@@ -431,40 +718,32 @@ func (channel *Channel) Mode(client *Client, changes ChannelModeChanges) {
 			member.Reply(reply)
 		}
 
-		if err := channel.Persist(); err != nil {
-			log.Println("Channel.Persist:", channel, err)
-		}
+		channel.Persist()
 	}
 }
 
-func (channel *Channel) Persist() (err error) {
-	if channel.flags[Persistent] {
-		_, err = channel.server.db.Exec(`
-            INSERT OR REPLACE INTO channel
-              (name, flags, key, topic, user_limit, ban_list, except_list,
-               invite_list)
-              VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
-			channel.name.String(), channel.flags.String(), channel.key.String(),
-			channel.topic.String(), channel.userLimit, channel.lists[BanMask].String(),
-			channel.lists[ExceptMask].String(), channel.lists[InviteMask].String())
-	} else {
-		_, err = channel.server.db.Exec(`
-            DELETE FROM channel WHERE name = ?`, channel.name.String())
+// Persist queues the channel to be saved, or deleted if it isn't +P.
+func (channel *Channel) Persist() {
+	if !channel.flags[Persistent] {
+		channel.server.persister.Delete(channel.name)
+		return
 	}
-	return
+	channel.server.persister.Save(channel.Record())
 }
 
 func (channel *Channel) Notice(client *Client, message Text) {
-	if !channel.CanSpeak(client) {
+	if !channel.CanSpeak(client, message) {
 		client.ErrCannotSendToChan(channel)
 		return
 	}
-	reply := RplNotice(client, channel, message)
+	replies := RplNotices(client, channel, message)
 	for member := range channel.members {
 		if member == client {
 			continue
 		}
-		member.Reply(reply)
+		for _, reply := range replies {
+			member.Reply(reply)
+		}
 	}
 }
 
@@ -473,7 +752,7 @@ func (channel *Channel) Quit(client *Client) {
 	client.channels.Remove(channel)
 
 	if !channel.flags[Persistent] && channel.IsEmpty() {
-		channel.server.channels.Remove(channel)
+		channel.server.removeChannel(channel)
 	}
 }
 
@@ -482,12 +761,16 @@ func (channel *Channel) Kick(client *Client, target *Client, comment Text) {
 		client.ErrNotOnChannel(channel)
 		return
 	}
-	if !channel.ClientIsOperator(client) {
+	if !channel.ClientHasRank(client, HalfOperator) {
 		client.ErrChanOPrivIsNeeded(channel)
 		return
 	}
 	if !channel.members.Has(target) {
-		client.ErrUserNotInChannel(channel, target)
+		client.ErrUserNotInChannel(channel, target.Nick())
+		return
+	}
+	if !channel.ClientCanActOn(client, target) {
+		client.ErrChanOPrivIsNeeded(channel)
 		return
 	}
 
@@ -498,8 +781,48 @@ func (channel *Channel) Kick(client *Client, target *Client, comment Text) {
 	channel.Quit(target)
 }
 
+// Knock asks the channel's ops to invite `client`.
+func (channel *Channel) Knock(client *Client, message Text) {
+	if channel.members.Has(client) {
+		client.ErrKnockOnChan(channel)
+		return
+	}
+
+	if !(channel.flags[InviteOnly] || (channel.key != "") || channel.IsFull()) {
+		client.ErrChanOpen(channel)
+		return
+	}
+
+	if channel.flags[NoKnock] || channel.IsBanned(client) {
+		client.ErrCannotSendToChan(channel)
+		return
+	}
+
+	now := time.Now()
+	if !client.knockThrottle.Allow(now) {
+		client.ErrTooManyKnock(channel, "user")
+		return
+	}
+	if !channel.knockThrottle.Allow(now) {
+		client.ErrTooManyKnock(channel, "channel")
+		return
+	}
+	client.knockThrottle.Record(now)
+	channel.knockThrottle.Record(now)
+
+	if message == "" {
+		message = "has asked for an invite."
+	}
+	for member := range channel.members {
+		if channel.ClientHasRank(member, HalfOperator) {
+			member.RplKnock(channel, client, message)
+		}
+	}
+	client.RplKnockDelivered(channel)
+}
+
 func (channel *Channel) Invite(invitee *Client, inviter *Client) {
-	if channel.flags[InviteOnly] && !channel.ClientIsOperator(inviter) {
+	if channel.flags[InviteOnly] && !channel.ClientHasRank(inviter, HalfOperator) {
 		inviter.ErrChanOPrivIsNeeded(channel)
 		return
 	}
@@ -510,10 +833,9 @@ func (channel *Channel) Invite(invitee *Client, inviter *Client) {
 	}
 
 	if channel.flags[InviteOnly] {
-		channel.lists[InviteMask].Add(invitee.UserHost())
-		if err := channel.Persist(); err != nil {
-			log.Println("Channel.Persist:", channel, err)
-		}
+		channel.lists[InviteMask].Add(invitee.UserHost(), inviter.UserHost(),
+			time.Now().Add(INVITE_TIMEOUT))
+		channel.Persist()
 	}
 
 	inviter.RplInviting(invitee, channel.name)
@@ -0,0 +1,196 @@
+package irc
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+)
+
+// The `ergonomadic channel` subcommands edit persistent channels in the
+// store while the server is stopped.
+
+func findChannelRecord(store Store, name Name) (*ChannelRecord, error) {
+	records, err := store.Channels()
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		if record.name.ToLower() == name.ToLower() {
+			return record, nil
+		}
+	}
+	return nil, nil
+}
+
+// channelAdmin is an IRC operator on a server of its own, loaded from the
+// store, so stored channels can be shown and changed by the same mode
+// handlers as MODE. It has no connection; refused changes are returned as
+// errors instead of replies.
+type channelAdmin struct {
+	client *Client
+	server *Server
+}
+
+func newChannelAdmin(store Store) *channelAdmin {
+	config := &Config{}
+	config.Server.Name = "localhost"
+	server := NewServer(config, store)
+	client := &Client{
+		capabilities: make(CapabilitySet),
+		channels:     make(ChannelSet),
+		flags:        map[UserMode]bool{Operator: true},
+		hostname:     server.name,
+		nick:         "admin",
+		server:       server,
+		username:     "admin",
+	}
+	return &channelAdmin{
+		client: client,
+		server: server,
+	}
+}
+
+// Close waits for anything the server queued for the store.
+func (admin *channelAdmin) Close() {
+	admin.server.persister.Close()
+}
+
+// channels are the server's channels, sorted by name.
+func (admin *channelAdmin) channels() []*Channel {
+	channels := make([]*Channel, 0, len(admin.server.channels))
+	for _, channel := range admin.server.channels {
+		channels = append(channels, channel)
+	}
+	sort.Sort(channelsByName(channels))
+	return channels
+}
+
+// AdminListChannels prints one line for each persistent channel.
+func AdminListChannels(store Store, out io.Writer) error {
+	admin := newChannelAdmin(store)
+	defer admin.Close()
+	for _, channel := range admin.channels() {
+		fmt.Fprintf(out, "%s %s :%s\n", channel, channel.ModeString(admin.client),
+			channel.topic)
+	}
+	return nil
+}
+
+// AdminShowChannel prints everything stored about a channel.
+func AdminShowChannel(store Store, name Name, out io.Writer) error {
+	admin := newChannelAdmin(store)
+	defer admin.Close()
+	channel := admin.server.channels.Get(name)
+	if channel == nil {
+		return fmt.Errorf("no such channel: %s", name)
+	}
+	record := channel.Record()
+
+	fmt.Fprintf(out, "name:    %s\n", record.name)
+	fmt.Fprintf(out, "modes:   %s\n", channel.ModeString(admin.client))
+	fmt.Fprintf(out, "created: %s\n", formatAdminTime(record.ctime))
+	fmt.Fprintf(out, "topic:   %s\n", record.topic)
+	fmt.Fprintf(out, "  set by %s at %s\n", record.topicSetBy,
+		formatAdminTime(record.topicTime))
+	for _, mode := range SupportedChannelModes {
+		masks := record.masks[mode]
+		if len(masks) == 0 {
+			continue
+		}
+		fmt.Fprintf(out, "+%s list:\n", mode)
+		for _, mask := range masks {
+			fmt.Fprintf(out, "  %s set by %s at %s", mask.mask, mask.setBy,
+				formatAdminTime(mask.setTime))
+			if !mask.expires.IsZero() {
+				fmt.Fprintf(out, ", expires %s", formatAdminTime(mask.expires))
+			}
+			fmt.Fprintln(out)
+		}
+	}
+	return nil
+}
+
+func formatAdminTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC1123)
+}
+
+// AdminSetChannel applies MODE-style changes, e.g. `+k key` or `-b mask`,
+// to a channel, creating it if necessary. A channel without +P is deleted.
+func AdminSetChannel(store Store, name Name, args []string) error {
+	if !name.IsChannel() {
+		return fmt.Errorf("invalid channel name: %s", name)
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("no modes given")
+	}
+
+	cmd, err := ParseChannelModeCommand(name, args)
+	if err != nil {
+		return err
+	}
+	changes := cmd.(*ChannelModeCommand).changes
+	for _, change := range changes {
+		spec := LookupChannelMode(change.mode)
+		if spec == nil {
+			return fmt.Errorf("unsupported channel mode: %s", change.mode)
+		}
+		if spec.kind == ChannelModePrefix {
+			return fmt.Errorf("membership mode %s can't be set offline", change.mode)
+		}
+		if (change.op != Add) && (change.op != Remove) {
+			return fmt.Errorf("mode %s needs + or -", change.mode)
+		}
+		needsArg := (change.op == Add) || (spec.kind == ChannelModeList)
+		if needsArg && spec.kind.TakesArg(change.op) && (change.arg == "") {
+			return fmt.Errorf("mode %s needs an argument", change.mode)
+		}
+	}
+
+	admin := newChannelAdmin(store)
+	defer admin.Close()
+	channel := admin.server.channels.Get(name)
+	if channel == nil {
+		channel = NewChannel(admin.server, name)
+		channel.flags[Persistent] = true
+	}
+	for _, change := range changes {
+		if _, err := channel.applyMode(admin.client, change); err != nil {
+			return fmt.Errorf("%s%s: %s", change.op, change.mode, err)
+		}
+	}
+
+	if !channel.flags[Persistent] {
+		return store.DeleteChannel(channel.name)
+	}
+	return store.SaveChannel(channel.Record())
+}
+
+// AdminDeleteChannel removes a channel and its mask lists.
+func AdminDeleteChannel(store Store, name Name) error {
+	record, err := findChannelRecord(store, name)
+	if err != nil {
+		return err
+	}
+	if record == nil {
+		return fmt.Errorf("no such channel: %s", name)
+	}
+	return store.DeleteChannel(record.name)
+}
+
+type channelsByName []*Channel
+
+func (channels channelsByName) Len() int {
+	return len(channels)
+}
+
+func (channels channelsByName) Less(i, j int) bool {
+	return channels[i].name < channels[j].name
+}
+
+func (channels channelsByName) Swap(i, j int) {
+	channels[i], channels[j] = channels[j], channels[i]
+}
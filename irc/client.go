@@ -1,6 +1,7 @@
 package irc
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"time"
@@ -12,41 +13,48 @@ const (
 )
 
 type Client struct {
-	atime        time.Time
-	authorized   bool
-	awayMessage  Text
-	capabilities CapabilitySet
-	capState     CapState
-	channels     ChannelSet
-	ctime        time.Time
-	flags        map[UserMode]bool
-	hasQuit      bool
-	hops         uint
-	hostname     Name
-	idleTimer    *time.Timer
-	nick         Name
-	quitTimer    *time.Timer
-	realname     Text
-	registered   bool
-	server       *Server
-	socket       *Socket
-	username     Name
+	account       Name // services account name, empty if not logged in
+	atime         time.Time
+	authorized    bool
+	awayMessage   Text
+	capabilities  CapabilitySet
+	capState      CapState
+	channels      ChannelSet
+	ctime         time.Time
+	flags         map[UserMode]bool
+	hasQuit       bool
+	hops          uint
+	hostname      Name
+	idleTimer     *time.Timer
+	ip            Name
+	knockThrottle *Throttle
+	listing       *ChannelListing
+	nick          Name
+	quitTimer     *time.Timer
+	realname      Text
+	registered    bool
+	server        *Server
+	socket        *Socket
+	username      Name
 }
 
 func NewClient(server *Server, conn net.Conn) *Client {
 	now := time.Now()
 	client := &Client{
-		atime:        now,
-		authorized:   server.password == nil,
-		capState:     CapNone,
-		capabilities: make(CapabilitySet),
-		channels:     make(ChannelSet),
-		ctime:        now,
-		flags:        make(map[UserMode]bool),
-		server:       server,
-		socket:       NewSocket(conn),
+		atime:         now,
+		authorized:    server.password == nil,
+		capState:      CapNone,
+		capabilities:  make(CapabilitySet),
+		channels:      make(ChannelSet),
+		ctime:         now,
+		flags:         make(map[UserMode]bool),
+		ip:            IPString(conn.RemoteAddr()),
+		knockThrottle: NewThrottle(1, KNOCK_CLIENT_DELAY),
+		server:        server,
+		socket:        NewSocket(conn),
 	}
 	client.Touch()
+	server.connections.Add(client)
 	go client.run()
 
 	return client
@@ -67,7 +75,10 @@ func (client *Client) run() {
 		client.socket.conn.RemoteAddr())))
 
 	for err == nil {
-		if line, err = client.socket.Read(); err != nil {
+		if line, err = client.socket.Read(); err == ErrInputTooLong {
+			command, err = NewInputTooLongCommand(), nil
+
+		} else if err != nil {
 			command = NewQuitCommand("connection closed")
 
 		} else if command, err = ParseCommand(line); err != nil {
@@ -162,6 +173,7 @@ func (client *Client) destroy() {
 	// clean up server
 
 	client.server.clients.Remove(client)
+	client.server.connections.Remove(client)
 
 	// clean up self
 
@@ -189,6 +201,11 @@ func (client *Client) IdleSeconds() uint64 {
 	return uint64(client.IdleTime().Seconds())
 }
 
+func (client *Client) IsSecure() bool {
+	_, ok := client.socket.conn.(*tls.Conn)
+	return ok
+}
+
 func (client *Client) HasNick() bool {
 	return client.nick != ""
 }
@@ -217,6 +234,20 @@ func (c *Client) UserHost() Name {
 	return Name(fmt.Sprintf("%s!%s@%s", c.Nick(), username, c.hostname))
 }
 
+// <nick> [ "*" ] "=" ( "+" / "-" ) <user>@<host>
+func (c *Client) UserHostReply() string {
+	reply := c.Nick().String()
+	if c.flags[Operator] {
+		reply += "*"
+	}
+	if c.flags[Away] {
+		reply += "=-"
+	} else {
+		reply += "=+"
+	}
+	return fmt.Sprintf("%s%s@%s", reply, c.username, c.hostname)
+}
+
 func (c *Client) Nick() Name {
 	if c.HasNick() {
 		return c.nick
@@ -256,7 +287,7 @@ func (client *Client) ChangeNickname(nickname Name) {
 	// Make reply before changing nick to capture original source id.
 	reply := RplNick(client, nickname)
 	client.server.clients.Remove(client)
-	client.server.whoWas.Append(client)
+	client.server.AddWhoWas(client)
 	client.nick = nickname
 	client.server.clients.Add(client)
 	for friend := range client.Friends() {
@@ -275,7 +306,7 @@ func (client *Client) Quit(message Text) {
 
 	client.hasQuit = true
 	client.Reply(RplError("quit"))
-	client.server.whoWas.Append(client)
+	client.server.AddWhoWas(client)
 	friends := client.Friends()
 	friends.Remove(client)
 	client.destroy()
@@ -1,11 +1,10 @@
 package irc
 
 import (
-	"database/sql"
 	"errors"
-	"log"
 	"regexp"
 	"strings"
+	"time"
 )
 
 var (
@@ -13,12 +12,6 @@ var (
 	ErrNicknameInUse    = errors.New("nickname in use")
 	ErrNicknameMismatch = errors.New("nickname mismatch")
 	wildMaskExpr        = regexp.MustCompile(`\*|\?`)
-	likeQuoter          = strings.NewReplacer(
-		`\`, `\\`,
-		`%`, `\%`,
-		`_`, `\_`,
-		`*`, `%`,
-		`?`, `_`)
 )
 
 func HasWildcards(mask string) bool {
@@ -37,19 +30,17 @@ func ExpandUserHost(userhost Name) (expanded Name) {
 	return
 }
 
-func QuoteLike(userhost Name) string {
-	return likeQuoter.Replace(userhost.String())
-}
-
 type ClientLookupSet struct {
-	byNick map[Name]*Client
-	db     *ClientDB
+	byNick     map[Name]*Client
+	bySkeleton map[Name]*Client
+	index      *MaskIndex
 }
 
 func NewClientLookupSet() *ClientLookupSet {
 	return &ClientLookupSet{
-		byNick: make(map[Name]*Client),
-		db:     NewClientDB(),
+		byNick:     make(map[Name]*Client),
+		bySkeleton: make(map[Name]*Client),
+		index:      NewMaskIndex(),
 	}
 }
 
@@ -65,7 +56,11 @@ func (clients *ClientLookupSet) Add(client *Client) error {
 		return ErrNicknameInUse
 	}
 	clients.byNick[client.Nick().ToLower()] = client
-	clients.db.Add(client)
+	skeleton := client.Nick().Skeleton()
+	if clients.bySkeleton[skeleton] == nil {
+		clients.bySkeleton[skeleton] = client
+	}
+	clients.index.Add(client)
 	return nil
 }
 
@@ -77,94 +72,37 @@ func (clients *ClientLookupSet) Remove(client *Client) error {
 		return ErrNicknameMismatch
 	}
 	delete(clients.byNick, client.nick.ToLower())
-	clients.db.Remove(client)
-	return nil
-}
-
-func (clients *ClientLookupSet) FindAll(userhost Name) (set ClientSet) {
-	userhost = ExpandUserHost(userhost)
-	set = make(ClientSet)
-	rows, err := clients.db.db.Query(
-		`SELECT nickname FROM client WHERE userhost LIKE ? ESCAPE '\'`,
-		QuoteLike(userhost))
-	if err != nil {
-		Log.error.Println("ClientLookupSet.FindAll.Query:", err)
-		return
+	skeleton := client.nick.Skeleton()
+	if clients.bySkeleton[skeleton] == client {
+		delete(clients.bySkeleton, skeleton)
 	}
-	for rows.Next() {
-		var sqlNickname string
-		err := rows.Scan(&sqlNickname)
-		if err != nil {
-			Log.error.Println("ClientLookupSet.FindAll.Scan:", err)
-			return
-		}
-		nickname := Name(sqlNickname)
-		client := clients.Get(nickname)
-		if client == nil {
-			Log.error.Println("ClientLookupSet.FindAll: missing client:", nickname)
-			continue
-		}
-		set.Add(client)
-	}
-	return
-}
-
-func (clients *ClientLookupSet) Find(userhost Name) *Client {
-	userhost = ExpandUserHost(userhost)
-	row := clients.db.db.QueryRow(
-		`SELECT nickname FROM client WHERE userhost LIKE ? ESCAPE '\' LIMIT 1`,
-		QuoteLike(userhost))
-	var nickname Name
-	err := row.Scan(&nickname)
-	if err != nil {
-		Log.error.Println("ClientLookupSet.Find:", err)
-		return nil
-	}
-	return clients.Get(nickname)
+	clients.index.Remove(client)
+	return nil
 }
 
-//
-// client db
-//
-
-type ClientDB struct {
-	db *sql.DB
+// GetConfusable returns a client whose nick looks like `nick`.
+func (clients *ClientLookupSet) GetConfusable(nick Name) *Client {
+	return clients.bySkeleton[nick.Skeleton()]
 }
 
-func NewClientDB() *ClientDB {
-	db := &ClientDB{
-		db: OpenDB(":memory:"),
-	}
-	stmts := []string{
-		`CREATE TABLE client (
-          nickname TEXT NOT NULL COLLATE NOCASE UNIQUE,
-          userhost TEXT NOT NULL COLLATE NOCASE,
-          UNIQUE (nickname, userhost) ON CONFLICT REPLACE)`,
-		`CREATE UNIQUE INDEX idx_nick ON client (nickname COLLATE NOCASE)`,
-		`CREATE UNIQUE INDEX idx_uh ON client (userhost COLLATE NOCASE)`,
-	}
-	for _, stmt := range stmts {
-		_, err := db.db.Exec(stmt)
-		if err != nil {
-			log.Fatal("NewClientDB: ", stmt, err)
-		}
-	}
-	return db
+// FindAll returns the clients matching a nick!user@host mask. Missing
+// parts of the mask are filled in with wildcards.
+func (clients *ClientLookupSet) FindAll(userhost Name) ClientSet {
+	return clients.index.FindAll(userhost)
 }
 
-func (db *ClientDB) Add(client *Client) {
-	_, err := db.db.Exec(`INSERT INTO client (nickname, userhost) VALUES (?, ?)`,
-		client.Nick().String(), client.UserHost().String())
-	if err != nil {
-		Log.error.Println("ClientDB.Add:", err)
+// Find returns any one client matching `userhost`, or nil.
+func (clients *ClientLookupSet) Find(userhost Name) *Client {
+	for client := range clients.index.FindAll(userhost) {
+		return client
 	}
+	return nil
 }
 
-func (db *ClientDB) Remove(client *Client) {
-	_, err := db.db.Exec(`DELETE FROM client WHERE nickname = ?`,
-		client.Nick().String())
-	if err != nil {
-		Log.error.Println("ClientDB.Remove:", err)
+// Update re-indexes a client whose username or hostname has changed.
+func (clients *ClientLookupSet) Update(client *Client) {
+	if clients.Get(client.nick) == client {
+		clients.index.Add(client)
 	}
 }
 
@@ -172,61 +110,95 @@ func (db *ClientDB) Remove(client *Client) {
 // usermask to regexp
 //
 
+// UserMask is an entry in a channel mask list.
+type UserMask struct {
+	mask    Name
+	setBy   Name
+	setTime time.Time
+	expires time.Time // zero for masks that don't expire
+}
+
+func (mask *UserMask) IsExpired(now time.Time) bool {
+	return !mask.expires.IsZero() && !now.Before(mask.expires)
+}
+
+// UserMaskSet is keyed by casefolded masks, and matches casefolded
+// userhosts.
 type UserMaskSet struct {
-	masks  map[Name]bool
-	regexp *regexp.Regexp
+	extBans []*ExtBan
+	masks   map[Name]*UserMask
+	regexp  *regexp.Regexp
 }
 
 func NewUserMaskSet() *UserMaskSet {
 	return &UserMaskSet{
-		masks: make(map[Name]bool),
+		masks: make(map[Name]*UserMask),
 	}
 }
 
-func (set *UserMaskSet) Add(mask Name) bool {
-	if set.masks[mask] {
+// Add records who set `mask`. A zero `expires` never expires.
+func (set *UserMaskSet) Add(mask Name, setBy Name, expires time.Time) bool {
+	if set.masks[mask.ToLower()] != nil {
 		return false
 	}
-	set.masks[mask] = true
+	set.masks[mask.ToLower()] = &UserMask{
+		mask:    mask,
+		setBy:   setBy,
+		setTime: time.Now(),
+		expires: expires,
+	}
 	set.setRegexp()
 	return true
 }
 
-func (set *UserMaskSet) AddAll(masks []Name) (added bool) {
+// Load restores masks from the database, with their expiry times. Masks
+// that expired while the server was down are left out.
+func (set *UserMaskSet) Load(masks []*UserMask) {
+	now := time.Now()
 	for _, mask := range masks {
-		if !added && !set.masks[mask] {
-			added = true
+		if mask.IsExpired(now) {
+			continue
 		}
-		set.masks[mask] = true
+		set.masks[mask.mask.ToLower()] = mask
 	}
 	set.setRegexp()
-	return
 }
 
 func (set *UserMaskSet) Remove(mask Name) bool {
-	if !set.masks[mask] {
+	if set.masks[mask.ToLower()] == nil {
 		return false
 	}
-	delete(set.masks, mask)
+	delete(set.masks, mask.ToLower())
 	set.setRegexp()
 	return true
 }
 
-func (set *UserMaskSet) Match(userhost Name) bool {
-	if set.regexp == nil {
-		return false
+// Expire removes and returns the masks that have expired by `now`.
+func (set *UserMaskSet) Expire(now time.Time) (expired []Name) {
+	for key, mask := range set.masks {
+		if mask.IsExpired(now) {
+			delete(set.masks, key)
+			expired = append(expired, mask.mask)
+		}
 	}
-	return set.regexp.MatchString(userhost.String())
+	if len(expired) > 0 {
+		set.setRegexp()
+	}
+	return
 }
 
-func (set *UserMaskSet) String() string {
-	masks := make([]string, len(set.masks))
-	index := 0
-	for mask := range set.masks {
-		masks[index] = mask.String()
-		index += 1
+// Match tests a client against both nick!user@host masks and extended
+// bans.
+func (set *UserMaskSet) Match(client *Client) bool {
+	if (set.regexp != nil) && set.regexp.MatchString(client.UserHost().ToLower().String()) {
+		return true
 	}
-	return strings.Join(masks, " ")
+	for _, extBan := range set.extBans {
+		if extBan.Match(client) {
+			return true
+		}
+	}
+	return false
 }
 
 // Generate a regular expression from the set of user mask
@@ -234,28 +206,44 @@ func (set *UserMaskSet) String() string {
 // `?`. All the pieces are meta-escaped. `*` is replaced with `.*`,
 // the regexp equivalent. Likewise, `?` is replaced with `.`. The
 // parts are re-joined and finally all masks are joined into a big
-// or-expression.
+// or-expression. Extended bans can't be expressed this way, so they
+// are kept aside and tested one by one.
 func (set *UserMaskSet) setRegexp() {
-	if len(set.masks) == 0 {
+	set.extBans = nil
+	maskExprs := make([]string, 0, len(set.masks))
+	for key, mask := range set.masks {
+		if IsExtBan(mask.mask) {
+			if extBan := ParseExtBan(mask.mask); extBan != nil {
+				set.extBans = append(set.extBans, extBan)
+			}
+			continue
+		}
+		maskExprs = append(maskExprs, maskExpr(key))
+	}
+
+	if len(maskExprs) == 0 {
 		set.regexp = nil
 		return
 	}
+	expr := "^(" + strings.Join(maskExprs, "|") + ")$"
+	set.regexp, _ = regexp.Compile(expr)
+}
 
-	maskExprs := make([]string, len(set.masks))
-	index := 0
-	for mask := range set.masks {
-		manyParts := strings.Split(mask.String(), "*")
-		manyExprs := make([]string, len(manyParts))
-		for mindex, manyPart := range manyParts {
-			oneParts := strings.Split(manyPart, "?")
-			oneExprs := make([]string, len(oneParts))
-			for oindex, onePart := range oneParts {
-				oneExprs[oindex] = regexp.QuoteMeta(onePart)
-			}
-			manyExprs[mindex] = strings.Join(oneExprs, ".")
+func maskExpr(mask Name) string {
+	manyParts := strings.Split(mask.String(), "*")
+	manyExprs := make([]string, len(manyParts))
+	for mindex, manyPart := range manyParts {
+		oneParts := strings.Split(manyPart, "?")
+		oneExprs := make([]string, len(oneParts))
+		for oindex, onePart := range oneParts {
+			oneExprs[oindex] = regexp.QuoteMeta(onePart)
 		}
-		maskExprs[index] = strings.Join(manyExprs, ".*")
+		manyExprs[mindex] = strings.Join(oneExprs, ".")
 	}
-	expr := "^" + strings.Join(maskExprs, "|") + "$"
-	set.regexp, _ = regexp.Compile(expr)
+	return strings.Join(manyExprs, ".*")
+}
+
+// MatchMask reports whether a single user mask matches `userhost`.
+func MatchMask(mask Name, userhost Name) bool {
+	return MatchWildcard(mask.String(), userhost.String())
 }
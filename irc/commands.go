@@ -6,6 +6,7 @@ import (
 	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Command interface {
@@ -26,37 +27,45 @@ var (
 	NotEnoughArgsError = errors.New("not enough arguments")
 	ErrParseCommand    = errors.New("failed to parse message")
 	parseCommandFuncs  = map[StringCode]parseCommandFunc{
-		AWAY:    ParseAwayCommand,
-		CAP:     ParseCapCommand,
-		DEBUG:   ParseDebugCommand,
-		INVITE:  ParseInviteCommand,
-		ISON:    ParseIsOnCommand,
-		JOIN:    ParseJoinCommand,
-		KICK:    ParseKickCommand,
-		KILL:    ParseKillCommand,
-		LIST:    ParseListCommand,
-		MODE:    ParseModeCommand,
-		MOTD:    ParseMOTDCommand,
-		NAMES:   ParseNamesCommand,
-		NICK:    ParseNickCommand,
-		NOTICE:  ParseNoticeCommand,
-		ONICK:   ParseOperNickCommand,
-		OPER:    ParseOperCommand,
-		PART:    ParsePartCommand,
-		PASS:    ParsePassCommand,
-		PING:    ParsePingCommand,
-		PONG:    ParsePongCommand,
-		PRIVMSG: ParsePrivMsgCommand,
-		PROXY:   ParseProxyCommand,
-		QUIT:    ParseQuitCommand,
-		THEATER: ParseTheaterCommand, // nonstandard
-		TIME:    ParseTimeCommand,
-		TOPIC:   ParseTopicCommand,
-		USER:    ParseUserCommand,
-		VERSION: ParseVersionCommand,
-		WHO:     ParseWhoCommand,
-		WHOIS:   ParseWhoisCommand,
-		WHOWAS:  ParseWhoWasCommand,
+		ADMIN:    ParseAdminCommand,
+		AWAY:     ParseAwayCommand,
+		CAP:      ParseCapCommand,
+		DEBUG:    ParseDebugCommand,
+		INFO:     ParseInfoCommand,
+		INVITE:   ParseInviteCommand,
+		ISON:     ParseIsOnCommand,
+		JOIN:     ParseJoinCommand,
+		KICK:     ParseKickCommand,
+		KILL:     ParseKillCommand,
+		KNOCK:    ParseKnockCommand,
+		LIST:     ParseListCommand,
+		LOGIN:    ParseLoginCommand,
+		LUSERS:   ParseLUsersCommand,
+		MODE:     ParseModeCommand,
+		MOTD:     ParseMOTDCommand,
+		NAMES:    ParseNamesCommand,
+		NICK:     ParseNickCommand,
+		NOTICE:   ParseNoticeCommand,
+		ONICK:    ParseOperNickCommand,
+		OPER:     ParseOperCommand,
+		PART:     ParsePartCommand,
+		PASS:     ParsePassCommand,
+		PING:     ParsePingCommand,
+		PONG:     ParsePongCommand,
+		PRIVMSG:  ParsePrivMsgCommand,
+		PROXY:    ParseProxyCommand,
+		QUIT:     ParseQuitCommand,
+		STATS:    ParseStatsCommand,
+		TBAN:     ParseTimedBanCommand, // nonstandard
+		THEATER:  ParseTheaterCommand,  // nonstandard
+		TIME:     ParseTimeCommand,
+		TOPIC:    ParseTopicCommand,
+		USER:     ParseUserCommand,
+		USERHOST: ParseUserHostCommand,
+		VERSION:  ParseVersionCommand,
+		WHO:      ParseWhoCommand,
+		WHOIS:    ParseWhoisCommand,
+		WHOWAS:   ParseWhoWasCommand,
 	}
 )
 
@@ -112,6 +121,10 @@ func splitArg(line string) (arg string, rest string) {
 
 func ParseLine(line string) (command StringCode, args []string) {
 	args = make([]string, 0)
+	if strings.HasPrefix(line, "@") {
+		// message tags aren't supported; ignore them
+		_, line = splitArg(line)
+	}
 	if strings.HasPrefix(line, ":") {
 		_, line = splitArg(line)
 	}
@@ -264,7 +277,7 @@ func ParseUserCommand(args []string) (Command, error) {
 			mode:   uint8(mode),
 			unused: args[2],
 		}
-		msg.username = NewName(args[0])
+		msg.username = NewName(args[0]).Truncate(limits.UserLen)
 		msg.realname = NewText(args[3])
 		return msg, nil
 	}
@@ -273,7 +286,7 @@ func ParseUserCommand(args []string) (Command, error) {
 		hostname:   NewName(args[1]),
 		servername: NewName(args[2]),
 	}
-	msg.username = NewName(args[0])
+	msg.username = NewName(args[0]).Truncate(limits.UserLen)
 	msg.realname = NewText(args[3])
 	return msg, nil
 }
@@ -401,7 +414,7 @@ func ParseTopicCommand(args []string) (Command, error) {
 	}
 	if len(args) > 1 {
 		msg.setTopic = true
-		msg.topic = NewText(args[1])
+		msg.topic = NewText(args[1]).Truncate(limits.TopicLen)
 	}
 	return msg, nil
 }
@@ -541,13 +554,10 @@ func ParseChannelModeCommand(channel Name, args []string) (Command, error) {
 				mode: ChannelMode(mode),
 				op:   op,
 			}
-			switch change.mode {
-			case Key, BanMask, ExceptMask, InviteMask, UserLimit,
-				ChannelOperator, ChannelCreator, Voice:
-				if len(args) > skipArgs {
-					change.arg = args[skipArgs]
-					skipArgs += 1
-				}
+			spec := LookupChannelMode(change.mode)
+			if (spec != nil) && spec.kind.TakesArg(op) && (len(args) > skipArgs) {
+				change.arg = args[skipArgs]
+				skipArgs += 1
 			}
 			cmd.changes = append(cmd.changes, change)
 		}
@@ -598,13 +608,24 @@ func ParseWhoisCommand(args []string) (Command, error) {
 	}, nil
 }
 
+// WhoxFields are the fields requested in a WHOX query, e.g. `%tcuhnfar`.
+type WhoxFields map[rune]bool
+
 type WhoCommand struct {
 	BaseCommand
 	mask         Name
 	operatorOnly bool
+	whox         bool
+	fields       WhoxFields
+	token        string
 }
 
+var (
+	whoxTokenExpr = regexp.MustCompile(`^[0-9]{1,3}$`)
+)
+
 // WHO [ <mask> [ "o" ] ]
+// WHO <mask> [ "o" ] "%" <fields> [ "," <token> ]
 func ParseWhoCommand(args []string) (Command, error) {
 	cmd := &WhoCommand{}
 
@@ -612,8 +633,27 @@ func ParseWhoCommand(args []string) (Command, error) {
 		cmd.mask = NewName(args[0])
 	}
 
-	if (len(args) > 1) && (args[1] == "o") {
-		cmd.operatorOnly = true
+	if len(args) > 1 {
+		flags, fields := args[1], ""
+		if index := strings.Index(flags, "%"); index >= 0 {
+			flags, fields = flags[:index], flags[index+1:]
+			cmd.whox = true
+		}
+
+		cmd.operatorOnly = strings.Contains(flags, "o")
+
+		if cmd.whox {
+			if index := strings.Index(fields, ","); index >= 0 {
+				if token := fields[index+1:]; whoxTokenExpr.MatchString(token) {
+					cmd.token = token
+				}
+				fields = fields[:index]
+			}
+			cmd.fields = make(WhoxFields)
+			for _, field := range fields {
+				cmd.fields[field] = true
+			}
+		}
 	}
 
 	return cmd, nil
@@ -641,6 +681,34 @@ func ParseOperCommand(args []string) (Command, error) {
 	return cmd, nil
 }
 
+type LoginCommand struct {
+	PassCommand
+	name    Name
+	account *AccountRecord
+}
+
+// LoadPassword reads the account on the client's goroutine, so the server
+// doesn't wait on the store.
+func (msg *LoginCommand) LoadPassword(server *Server) {
+	msg.account, msg.err = server.store.Account(msg.name)
+	if msg.account != nil {
+		msg.hash = msg.account.passwordHash
+	}
+}
+
+// LOGIN <account> <password>
+func ParseLoginCommand(args []string) (Command, error) {
+	if len(args) < 2 {
+		return nil, NotEnoughArgsError
+	}
+
+	cmd := &LoginCommand{
+		name: NewName(args[0]),
+	}
+	cmd.password = []byte(args[1])
+	return cmd, nil
+}
+
 type CapCommand struct {
 	BaseCommand
 	subCommand   CapSubCommand
@@ -666,6 +734,16 @@ func ParseCapCommand(args []string) (Command, error) {
 	return cmd, nil
 }
 
+// InputTooLongCommand reports a line the client's socket skipped, so the
+// server goroutine can reply. It has no code because clients can't send it.
+type InputTooLongCommand struct {
+	BaseCommand
+}
+
+func NewInputTooLongCommand() *InputTooLongCommand {
+	return &InputTooLongCommand{}
+}
+
 // HAPROXY support
 type ProxyCommand struct {
 	BaseCommand
@@ -708,7 +786,7 @@ func ParseAwayCommand(args []string) (Command, error) {
 	cmd := &AwayCommand{}
 
 	if len(args) > 0 {
-		cmd.text = NewText(args[0])
+		cmd.text = NewText(args[0]).Truncate(limits.AwayLen)
 	}
 
 	return cmd, nil
@@ -791,21 +869,28 @@ func ParseKickCommand(args []string) (Command, error) {
 		}
 	}
 	if len(args) > 2 {
-		cmd.comment = NewText(args[2])
+		cmd.comment = NewText(args[2]).Truncate(limits.KickLen)
 	}
 	return cmd, nil
 }
 
 type ListCommand struct {
 	BaseCommand
-	channels []Name
-	target   Name
+	filter *ListFilter
+	target Name
 }
 
+// LIST [ <channel/filter> *( "," <channel/filter> ) [ <target> ] ]
 func ParseListCommand(args []string) (Command, error) {
-	cmd := &ListCommand{}
+	cmd := &ListCommand{
+		filter: NewListFilter(),
+	}
 	if len(args) > 0 {
-		cmd.channels = NewNames(strings.Split(args[0], ","))
+		filter, err := ParseListFilter(strings.Split(args[0], ","))
+		if err != nil {
+			return nil, err
+		}
+		cmd.filter = filter
 	}
 	if len(args) > 1 {
 		cmd.target = NewName(args[1])
@@ -875,6 +960,27 @@ func ParseInviteCommand(args []string) (Command, error) {
 	}, nil
 }
 
+type KnockCommand struct {
+	BaseCommand
+	channel Name
+	message Text
+}
+
+// KNOCK <channel> [<message>]
+func ParseKnockCommand(args []string) (Command, error) {
+	if len(args) < 1 {
+		return nil, NotEnoughArgsError
+	}
+
+	cmd := &KnockCommand{
+		channel: NewName(args[0]),
+	}
+	if len(args) > 1 {
+		cmd.message = NewText(args[1])
+	}
+	return cmd, nil
+}
+
 func ParseTheaterCommand(args []string) (Command, error) {
 	if len(args) < 1 {
 		return nil, NotEnoughArgsError
@@ -962,3 +1068,125 @@ func ParseOperNickCommand(args []string) (Command, error) {
 		nick:   NewName(args[1]),
 	}, nil
 }
+
+// LUSERS [ <mask> [ <target> ] ]
+
+type LUsersCommand struct {
+	BaseCommand
+	mask   Name
+	target Name
+}
+
+func ParseLUsersCommand(args []string) (Command, error) {
+	cmd := &LUsersCommand{}
+	if len(args) > 0 {
+		cmd.mask = NewName(args[0])
+	}
+	if len(args) > 1 {
+		cmd.target = NewName(args[1])
+	}
+	return cmd, nil
+}
+
+// ADMIN [ <target> ]
+
+type AdminCommand struct {
+	BaseCommand
+	target Name
+}
+
+func ParseAdminCommand(args []string) (Command, error) {
+	cmd := &AdminCommand{}
+	if len(args) > 0 {
+		cmd.target = NewName(args[0])
+	}
+	return cmd, nil
+}
+
+// INFO [ <target> ]
+
+type InfoCommand struct {
+	BaseCommand
+	target Name
+}
+
+func ParseInfoCommand(args []string) (Command, error) {
+	cmd := &InfoCommand{}
+	if len(args) > 0 {
+		cmd.target = NewName(args[0])
+	}
+	return cmd, nil
+}
+
+// STATS <query> [ <target> ]
+
+type StatsCommand struct {
+	BaseCommand
+	query  rune
+	target Name
+}
+
+func ParseStatsCommand(args []string) (Command, error) {
+	if (len(args) < 1) || (len(args[0]) == 0) {
+		return nil, NotEnoughArgsError
+	}
+	cmd := &StatsCommand{
+		query: []rune(args[0])[0],
+	}
+	if len(args) > 1 {
+		cmd.target = NewName(args[1])
+	}
+	return cmd, nil
+}
+
+// USERHOST <nickname> *( SPACE <nickname> )
+
+type UserHostCommand struct {
+	BaseCommand
+	nicknames []Name
+}
+
+func ParseUserHostCommand(args []string) (Command, error) {
+	if len(args) == 0 {
+		return nil, NotEnoughArgsError
+	}
+	if len(args) > 5 {
+		args = args[:5]
+	}
+	return &UserHostCommand{
+		nicknames: NewNames(args),
+	}, nil
+}
+
+// TBAN <channel> <duration> <mask>
+//
+// The duration is a number of seconds or a Go duration such as "1h30m".
+
+type TimedBanCommand struct {
+	BaseCommand
+	channel  Name
+	duration time.Duration
+	mask     Name
+}
+
+func ParseTimedBanCommand(args []string) (Command, error) {
+	if len(args) < 3 {
+		return nil, NotEnoughArgsError
+	}
+
+	var duration time.Duration
+	if seconds, err := strconv.ParseUint(args[1], 10, 32); err == nil {
+		duration = time.Duration(seconds) * time.Second
+	} else if duration, err = time.ParseDuration(args[1]); err != nil {
+		return nil, ErrParseCommand
+	}
+	if duration <= 0 {
+		return nil, ErrParseCommand
+	}
+
+	return &TimedBanCommand{
+		channel:  NewName(args[0]),
+		duration: duration,
+		mask:     NewName(args[2]),
+	}, nil
+}
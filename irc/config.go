@@ -2,6 +2,7 @@ package irc
 
 import (
 	"code.google.com/p/gcfg"
+	"crypto/tls"
 	"errors"
 	"log"
 )
@@ -18,19 +19,57 @@ func (conf *PassConfig) PasswordBytes() []byte {
 	return bytes
 }
 
+type TLSListenConfig struct {
+	Cert string
+	Key  string
+}
+
+func (conf *TLSListenConfig) Config() *tls.Config {
+	cert, err := tls.LoadX509KeyPair(conf.Cert, conf.Key)
+	if err != nil {
+		log.Fatal("tls cert/key error: ", err)
+	}
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+	}
+}
+
+type BanConfig struct {
+	Reason string
+}
+
 type Config struct {
 	Server struct {
 		PassConfig
-		Database string
-		Listen   []string
-		Log      string
-		MOTD     string
-		Name     string
+		CaseMapping string
+		Database    string
+		Listen      []string
+		Log         string
+		MOTD        string
+		Name        string
+		Scripts     string
+	}
+
+	Admin struct {
+		Location1 string
+		Location2 string
+		Email     string
+	}
+
+	Ban map[string]*BanConfig
+
+	Limits Limits
+
+	WhoWas struct {
+		Size    uint
+		Persist bool
 	}
 
 	Operator map[string]*PassConfig
 
 	Theater map[string]*PassConfig
+
+	TLS map[string]*TLSListenConfig
 }
 
 func (conf *Config) Operators() map[Name][]byte {
@@ -53,6 +92,14 @@ func (conf *Config) Theaters() map[Name][]byte {
 	return theaters
 }
 
+func (conf *Config) Bans() map[Name]Text {
+	bans := make(map[Name]Text)
+	for mask, banConf := range conf.Ban {
+		bans[ExpandUserHost(NewName(mask))] = NewText(banConf.Reason)
+	}
+	return bans
+}
+
 func LoadConfig(filename string) (config *Config, err error) {
 	config = &Config{}
 	err = gcfg.ReadFileInto(config, filename)
@@ -67,9 +114,29 @@ func LoadConfig(filename string) (config *Config, err error) {
 		err = errors.New("server.database missing")
 		return
 	}
-	if len(config.Server.Listen) == 0 {
+	if (len(config.Server.Listen) == 0) && (len(config.TLS) == 0) {
 		err = errors.New("server.listen missing")
 		return
 	}
+	if _, err = ParseCaseMapping(config.Server.CaseMapping); err != nil {
+		return
+	}
+	if _, err = ParseScriptRestriction(config.Server.Scripts); err != nil {
+		return
+	}
 	return
 }
+
+// CaseMapping is the configured casemapping. LoadConfig has already
+// checked it.
+func (conf *Config) CaseMapping() CaseMapping {
+	mapping, _ := ParseCaseMapping(conf.Server.CaseMapping)
+	return mapping
+}
+
+// Scripts is how scripts may be mixed in nicks and channel names.
+// LoadConfig has already checked it.
+func (conf *Config) Scripts() ScriptRestriction {
+	restriction, _ := ParseScriptRestriction(conf.Server.Scripts)
+	return restriction
+}
@@ -0,0 +1,171 @@
+package irc
+
+import (
+	"code.google.com/p/go.text/unicode/norm"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Nicks and channel names that look alike are treated as the same name,
+// following the skeleton algorithm of Unicode Technical Standard #39:
+// casefold, decompose, replace each confusable character with its
+// prototype, decompose again and casefold again.
+//
+// confusables is the part of the Unicode confusables.txt table that maps
+// characters allowed in names to Latin letters and digits. Compatibility
+// forms like fullwidth letters are already removed by NFKC in NewName.
+var confusables = map[rune]string{
+	// Latin and digits
+	'0': "o", '1': "l", '|': "l", 'm': "rn", 'ı': "i", 'ɑ': "a", 'ɡ': "g",
+	'ɩ': "i", 'ǀ': "l",
+
+	// Cyrillic
+	'а': "a", 'А': "A", 'В': "B", 'с': "c", 'С': "C", 'ԁ': "d", 'е': "e",
+	'Е': "E", 'һ': "h", 'Н': "H", 'і': "i", 'І': "l", 'ӏ': "l", 'Ӏ': "l",
+	'ј': "j", 'Ј': "J", 'К': "K", 'М': "M", 'о': "o", 'О': "O", 'р': "p",
+	'Р': "P", 'ԛ': "q", 'Ԛ': "Q", 'ѕ': "s", 'Ѕ': "S", 'Т': "T", 'ԝ': "w",
+	'Ԝ': "W", 'х': "x", 'Х': "X", 'у': "y", 'ү': "y", 'У': "Y", 'Ү': "Y",
+	'З': "3", 'б': "6",
+
+	// Greek
+	'α': "a", 'Α': "A", 'Β': "B", 'ϲ': "c", 'Ϲ': "C", 'Ε': "E", 'Η': "H",
+	'ι': "i", 'Ι': "l", 'ϳ': "j", 'Κ': "K", 'Μ': "M", 'Ν': "N", 'ν': "v",
+	'ο': "o", 'Ο': "O", 'σ': "o", 'ρ': "p", 'Ρ': "P", 'Τ': "T", 'υ': "u",
+	'γ': "y", 'Υ': "Y", 'Χ': "X", 'Ζ': "Z",
+
+	// Armenian
+	'հ': "h", 'ո': "n", 'օ': "o", 'Օ': "O", 'զ': "q", 'Տ': "S", 'ս': "u",
+	'Ս': "U",
+
+	// Cherokee
+	'Ꭺ': "A", 'Ᏼ': "B", 'Ꮯ': "C", 'Ꭼ': "E", 'Ꮋ': "H", 'Ꮶ': "K", 'Ꮇ': "M",
+	'Ꮲ': "P", 'Ꮪ': "S", 'Ꭲ': "T", 'Ꮃ': "W", 'Ꮓ': "Z",
+}
+
+// Skeleton is the form of a name that is equal for names that look the
+// same.
+func (name Name) Skeleton() Name {
+	decomposed := norm.NFD.String(name.ToLower().String())
+	mapped := make([]string, 0, len(decomposed))
+	for _, r := range decomposed {
+		if prototype, ok := confusables[r]; ok {
+			mapped = append(mapped, prototype)
+		} else {
+			mapped = append(mapped, string(r))
+		}
+	}
+	return Name(norm.NFD.String(strings.Join(mapped, ""))).ToLower()
+}
+
+// ScriptRestriction limits how scripts may be mixed in a nick or channel
+// name. The levels are the restriction levels of UTS #39, from strictest
+// to loosest.
+type ScriptRestriction string
+
+const (
+	ScriptsASCII                 ScriptRestriction = "ascii"
+	ScriptsSingle                ScriptRestriction = "single-script"
+	ScriptsHighlyRestrictive     ScriptRestriction = "highly-restrictive"
+	ScriptsModeratelyRestrictive ScriptRestriction = "moderately-restrictive"
+	ScriptsUnrestricted          ScriptRestriction = "unrestricted"
+
+	DEFAULT_SCRIPTS = ScriptsModeratelyRestrictive
+)
+
+// script sets that highly-restrictive names may mix
+var highlyRestrictiveScripts = [][]string{
+	{"Latin", "Han", "Hiragana", "Katakana"},
+	{"Latin", "Han", "Bopomofo"},
+	{"Latin", "Han", "Hangul"},
+}
+
+func ParseScriptRestriction(name string) (ScriptRestriction, error) {
+	switch restriction := ScriptRestriction(strings.ToLower(name)); restriction {
+	case "":
+		return DEFAULT_SCRIPTS, nil
+	case ScriptsASCII, ScriptsSingle, ScriptsHighlyRestrictive,
+		ScriptsModeratelyRestrictive, ScriptsUnrestricted:
+		return restriction, nil
+	}
+	return "", fmt.Errorf("unknown script restriction: %s", name)
+}
+
+func (restriction ScriptRestriction) String() string {
+	return string(restriction)
+}
+
+// Allows reports whether `name` mixes scripts no more than `restriction`
+// allows. Characters common to all scripts, like digits and punctuation,
+// don't count.
+func (restriction ScriptRestriction) Allows(name Name) bool {
+	switch restriction {
+	case ScriptsUnrestricted:
+		return true
+
+	case ScriptsASCII:
+		for _, r := range name.String() {
+			if r > unicode.MaxASCII {
+				return false
+			}
+		}
+		return true
+	}
+
+	scripts := nameScripts(name)
+	if len(scripts) <= 1 {
+		return true
+	}
+	if restriction == ScriptsSingle {
+		return false
+	}
+
+	for _, allowed := range highlyRestrictiveScripts {
+		if scripts.SubsetOf(allowed) {
+			return true
+		}
+	}
+	if restriction == ScriptsHighlyRestrictive {
+		return false
+	}
+
+	// moderately restrictive: Latin and one other script, but not one with
+	// lots of Latin lookalikes
+	return (len(scripts) == 2) && scripts["Latin"] &&
+		!scripts["Cyrillic"] && !scripts["Greek"]
+}
+
+type scriptSet map[string]bool
+
+func (set scriptSet) SubsetOf(scripts []string) bool {
+	count := 0
+	for _, script := range scripts {
+		if set[script] {
+			count += 1
+		}
+	}
+	return count == len(set)
+}
+
+func nameScripts(name Name) scriptSet {
+	scripts := make(scriptSet)
+	for _, r := range name.String() {
+		if unicode.In(r, unicode.Common, unicode.Inherited) {
+			continue
+		}
+		scripts[runeScript(r)] = true
+	}
+	return scripts
+}
+
+func runeScript(r rune) string {
+	if unicode.Is(unicode.Latin, r) {
+		return "Latin"
+	}
+	for script, table := range unicode.Scripts {
+		if unicode.Is(table, r) {
+			return script
+		}
+	}
+	return "Unknown"
+}
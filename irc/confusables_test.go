@@ -0,0 +1,73 @@
+package irc
+
+import (
+	"testing"
+)
+
+func TestNameSkeleton(t *testing.T) {
+	tests := []struct {
+		a, b string
+		same bool
+	}{
+		{"dan", "DAN", true},
+		{"paypal", "pаypаl", true}, // Cyrillic а
+		{"paypal", "ΡAYΡAL", true}, // Greek Ρ
+		{"modern", "rnodern", true},
+		{"lol", "l0l", true},
+		{"lol", "1ol", true},
+		{"lol", "|ol", true},
+		{"#chan", "#сhаn", true},
+		{"cafe", "café", false},
+		{"caf\u00e9", "cafe\u0301", true},
+		{"dan", "dean", false},
+		{"даня", "dan", false},
+	}
+	for _, test := range tests {
+		a, b := Name(test.a).Skeleton(), Name(test.b).Skeleton()
+		if (a == b) != test.same {
+			t.Errorf("skeletons of %q and %q: %q and %q", test.a, test.b, a, b)
+		}
+	}
+}
+
+func TestParseScriptRestriction(t *testing.T) {
+	for _, name := range []string{"", "ascii", "Single-Script", "unrestricted"} {
+		if _, err := ParseScriptRestriction(name); err != nil {
+			t.Errorf("ParseScriptRestriction(%q): %s", name, err)
+		}
+	}
+	if _, err := ParseScriptRestriction("minimally-restrictive"); err == nil {
+		t.Error("parsed an unknown script restriction")
+	}
+}
+
+func TestScriptRestrictionAllows(t *testing.T) {
+	restrictions := []ScriptRestriction{ScriptsASCII, ScriptsSingle,
+		ScriptsHighlyRestrictive, ScriptsModeratelyRestrictive,
+		ScriptsUnrestricted}
+	tests := []struct {
+		name  string
+		allow [5]bool // in the order of restrictions
+	}{
+		{"dan_1", [5]bool{true, true, true, true, true}},
+		{"dän", [5]bool{false, true, true, true, true}},
+		{"даня", [5]bool{false, true, true, true, true}},
+		{"даня_1", [5]bool{false, true, true, true, true}},
+		{"dаn", [5]bool{false, false, false, false, true}}, // Cyrillic а
+		{"danα", [5]bool{false, false, false, false, true}},
+		{"dan小丹", [5]bool{false, false, true, true, true}},
+		{"小丹ひら", [5]bool{false, false, true, true, true}},
+		{"dan한", [5]bool{false, false, true, true, true}},
+		{"danא", [5]bool{false, false, false, true, true}},
+		{"小丹한ひ", [5]bool{false, false, false, false, true}},
+	}
+	for _, test := range tests {
+		for index, restriction := range restrictions {
+			allow := restriction.Allows(Name(test.name))
+			if allow != test.allow[index] {
+				t.Errorf("%s.Allows(%q) = %t, want %t",
+					restriction, test.name, allow, test.allow[index])
+			}
+		}
+	}
+}
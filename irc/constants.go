@@ -4,40 +4,50 @@ const (
 	SEM_VER       = "ergonomadic-1.4.4"
 	CRLF          = "\r\n"
 	MAX_REPLY_LEN = 512 - len(CRLF)
+	MAX_INPUT_LEN = 512 - len(CRLF) // not counting message tags
+	MAX_TAGS_LEN  = 8191            // message tags, with the @ and a space
 
 	// string codes
-	AWAY    StringCode = "AWAY"
-	CAP     StringCode = "CAP"
-	DEBUG   StringCode = "DEBUG"
-	ERROR   StringCode = "ERROR"
-	INVITE  StringCode = "INVITE"
-	ISON    StringCode = "ISON"
-	JOIN    StringCode = "JOIN"
-	KICK    StringCode = "KICK"
-	KILL    StringCode = "KILL"
-	LIST    StringCode = "LIST"
-	MODE    StringCode = "MODE"
-	MOTD    StringCode = "MOTD"
-	NAMES   StringCode = "NAMES"
-	NICK    StringCode = "NICK"
-	NOTICE  StringCode = "NOTICE"
-	ONICK   StringCode = "ONICK"
-	OPER    StringCode = "OPER"
-	PART    StringCode = "PART"
-	PASS    StringCode = "PASS"
-	PING    StringCode = "PING"
-	PONG    StringCode = "PONG"
-	PRIVMSG StringCode = "PRIVMSG"
-	PROXY   StringCode = "PROXY"
-	QUIT    StringCode = "QUIT"
-	THEATER StringCode = "THEATER" // nonstandard
-	TIME    StringCode = "TIME"
-	TOPIC   StringCode = "TOPIC"
-	USER    StringCode = "USER"
-	VERSION StringCode = "VERSION"
-	WHO     StringCode = "WHO"
-	WHOIS   StringCode = "WHOIS"
-	WHOWAS  StringCode = "WHOWAS"
+	ADMIN    StringCode = "ADMIN"
+	AWAY     StringCode = "AWAY"
+	CAP      StringCode = "CAP"
+	DEBUG    StringCode = "DEBUG"
+	ERROR    StringCode = "ERROR"
+	INFO     StringCode = "INFO"
+	INVITE   StringCode = "INVITE"
+	ISON     StringCode = "ISON"
+	JOIN     StringCode = "JOIN"
+	KICK     StringCode = "KICK"
+	KILL     StringCode = "KILL"
+	KNOCK    StringCode = "KNOCK"
+	LIST     StringCode = "LIST"
+	LOGIN    StringCode = "LOGIN" // nonstandard
+	LUSERS   StringCode = "LUSERS"
+	MODE     StringCode = "MODE"
+	MOTD     StringCode = "MOTD"
+	NAMES    StringCode = "NAMES"
+	NICK     StringCode = "NICK"
+	NOTICE   StringCode = "NOTICE"
+	ONICK    StringCode = "ONICK"
+	OPER     StringCode = "OPER"
+	PART     StringCode = "PART"
+	PASS     StringCode = "PASS"
+	PING     StringCode = "PING"
+	PONG     StringCode = "PONG"
+	PRIVMSG  StringCode = "PRIVMSG"
+	PROXY    StringCode = "PROXY"
+	QUIT     StringCode = "QUIT"
+	STATS    StringCode = "STATS"
+	TBAN     StringCode = "TBAN"    // nonstandard
+	THEATER  StringCode = "THEATER" // nonstandard
+	TIME     StringCode = "TIME"
+	TOPIC    StringCode = "TOPIC"
+	USER     StringCode = "USER"
+	USERHOST StringCode = "USERHOST"
+	VERSION  StringCode = "VERSION"
+	WHO      StringCode = "WHO"
+	WHOIS    StringCode = "WHOIS"
+	WHOWAS   StringCode = "WHOWAS"
 
 	// numeric codes
 	RPL_WELCOME           NumericCode = 1
@@ -45,6 +55,7 @@ const (
 	RPL_CREATED           NumericCode = 3
 	RPL_MYINFO            NumericCode = 4
 	RPL_BOUNCE            NumericCode = 5
+	RPL_ISUPPORT          NumericCode = 5
 	RPL_TRACELINK         NumericCode = 200
 	RPL_TRACECONNECTING   NumericCode = 201
 	RPL_TRACEHANDSHAKE    NumericCode = 202
@@ -58,6 +69,7 @@ const (
 	RPL_TRACERECONNECT    NumericCode = 210
 	RPL_STATSLINKINFO     NumericCode = 211
 	RPL_STATSCOMMANDS     NumericCode = 212
+	RPL_STATSKLINE        NumericCode = 216
 	RPL_ENDOFSTATS        NumericCode = 219
 	RPL_UMODEIS           NumericCode = 221
 	RPL_SERVLIST          NumericCode = 234
@@ -93,8 +105,12 @@ const (
 	RPL_LISTEND           NumericCode = 323
 	RPL_CHANNELMODEIS     NumericCode = 324
 	RPL_UNIQOPIS          NumericCode = 325
+	RPL_CREATIONTIME      NumericCode = 329
+	RPL_WHOISACCOUNT      NumericCode = 330
 	RPL_NOTOPIC           NumericCode = 331
 	RPL_TOPIC             NumericCode = 332
+	RPL_TOPICWHOTIME      NumericCode = 333
+	RPL_WHOISACTUALLY     NumericCode = 338
 	RPL_INVITING          NumericCode = 341
 	RPL_SUMMONING         NumericCode = 342
 	RPL_INVITELIST        NumericCode = 346
@@ -104,6 +120,7 @@ const (
 	RPL_VERSION           NumericCode = 351
 	RPL_WHOREPLY          NumericCode = 352
 	RPL_NAMREPLY          NumericCode = 353
+	RPL_WHOSPCRPL         NumericCode = 354
 	RPL_LINKS             NumericCode = 364
 	RPL_ENDOFLINKS        NumericCode = 365
 	RPL_ENDOFNAMES        NumericCode = 366
@@ -138,6 +155,7 @@ const (
 	ERR_NOTOPLEVEL        NumericCode = 413
 	ERR_WILDTOPLEVEL      NumericCode = 414
 	ERR_BADMASK           NumericCode = 415
+	ERR_INPUTTOOLONG      NumericCode = 417
 	ERR_UNKNOWNCOMMAND    NumericCode = 421
 	ERR_NOMOTD            NumericCode = 422
 	ERR_NOADMININFO       NumericCode = 423
@@ -145,6 +163,7 @@ const (
 	ERR_NONICKNAMEGIVEN   NumericCode = 431
 	ERR_ERRONEUSNICKNAME  NumericCode = 432
 	ERR_NICKNAMEINUSE     NumericCode = 433
+	ERR_BANNICKCHANGE     NumericCode = 435
 	ERR_NICKCOLLISION     NumericCode = 436
 	ERR_UNAVAILRESOURCE   NumericCode = 437
 	ERR_USERNOTINCHANNEL  NumericCode = 441
@@ -161,6 +180,7 @@ const (
 	ERR_YOUREBANNEDCREEP  NumericCode = 465
 	ERR_YOUWILLBEBANNED   NumericCode = 466
 	ERR_KEYSET            NumericCode = 467
+	ERR_LINKCHANNEL       NumericCode = 470
 	ERR_CHANNELISFULL     NumericCode = 471
 	ERR_UNKNOWNMODE       NumericCode = 472
 	ERR_INVITEONLYCHAN    NumericCode = 473
@@ -168,13 +188,28 @@ const (
 	ERR_BADCHANNELKEY     NumericCode = 475
 	ERR_BADCHANMASK       NumericCode = 476
 	ERR_NOCHANMODES       NumericCode = 477
+	ERR_NEEDREGGEDNICK    NumericCode = 477
 	ERR_BANLISTFULL       NumericCode = 478
+	ERR_BADCHANNAME       NumericCode = 479
+	ERR_THROTTLE          NumericCode = 480
 	ERR_NOPRIVILEGES      NumericCode = 481
 	ERR_CHANOPRIVSNEEDED  NumericCode = 482
 	ERR_CANTKILLSERVER    NumericCode = 483
 	ERR_RESTRICTED        NumericCode = 484
 	ERR_UNIQOPPRIVSNEEDED NumericCode = 485
+	ERR_SECUREONLYCHAN    NumericCode = 489
 	ERR_NOOPERHOST        NumericCode = 491
 	ERR_UMODEUNKNOWNFLAG  NumericCode = 501
 	ERR_USERSDONTMATCH    NumericCode = 502
+
+	// numeric codes from later extensions, in numeric order
+	RPL_WHOISSECURE    NumericCode = 671
+	RPL_KNOCK          NumericCode = 710
+	RPL_KNOCKDLVR      NumericCode = 711
+	ERR_TOOMANYKNOCK   NumericCode = 712
+	ERR_CHANOPEN       NumericCode = 713
+	ERR_KNOCKONCHAN    NumericCode = 714
+	RPL_QUIETLIST      NumericCode = 728
+	RPL_ENDOFQUIETLIST NumericCode = 729
+	RPL_LOGGEDIN       NumericCode = 900
 )
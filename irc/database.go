@@ -6,37 +6,606 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 	"log"
 	"os"
+	"strings"
+	"time"
 )
 
-func InitDB(path string) {
-	os.Remove(path)
+// Migrations are applied in order, each in its own transaction, and
+// recorded in the schema_version table. Never change a released migration;
+// add a new one instead. Every migration must also be safe to apply to a
+// database created before schema_version existed.
+type Migration struct {
+	version     int
+	description string
+	apply       func(*sql.Tx) error
+}
+
+func (migration *Migration) String() string {
+	return fmt.Sprintf("%d: %s", migration.version, migration.description)
+}
+
+var migrations = []*Migration{
+	{1, "create channel table", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+            CREATE TABLE IF NOT EXISTS channel (
+              name TEXT NOT NULL UNIQUE,
+              flags TEXT DEFAULT '',
+              key TEXT DEFAULT '',
+              topic TEXT DEFAULT '',
+              user_limit INTEGER DEFAULT 0)`)
+		return err
+	}},
+	{2, "move mask lists to channel_mask table", func(tx *sql.Tx) error {
+		if _, err := tx.Exec(createChannelMaskTable); err != nil {
+			return err
+		}
+		existing, err := tableColumns(tx, "channel")
+		if err != nil {
+			return err
+		}
+		return migrateChannelMasks(tx, existing)
+	}},
+	{3, "add topic setter and creation times", func(tx *sql.Tx) error {
+		return addColumns(tx, "channel", []columnDecl{
+			{"topic_set_by", "TEXT DEFAULT ''"},
+			{"topic_time", "INTEGER DEFAULT 0"},
+			{"created_time", "INTEGER DEFAULT 0"},
+		})
+	}},
+	{4, "add join throttle and forward", func(tx *sql.Tx) error {
+		return addColumns(tx, "channel", []columnDecl{
+			{"join_throttle", "TEXT DEFAULT ''"},
+			{"forward", "TEXT DEFAULT ''"},
+		})
+	}},
+	{5, "create account, server_ban and whowas tables", func(tx *sql.Tx) error {
+		stmts := []string{`
+            CREATE TABLE IF NOT EXISTS account (
+              name TEXT NOT NULL UNIQUE,
+              password_hash BLOB,
+              created_time INTEGER DEFAULT 0)`, `
+            CREATE TABLE IF NOT EXISTS server_ban (
+              mask TEXT NOT NULL UNIQUE,
+              reason TEXT DEFAULT '',
+              set_by TEXT DEFAULT '',
+              set_time INTEGER DEFAULT 0)`, `
+            CREATE TABLE IF NOT EXISTS whowas (
+              id INTEGER PRIMARY KEY AUTOINCREMENT,
+              nickname TEXT NOT NULL,
+              username TEXT DEFAULT '',
+              hostname TEXT DEFAULT '',
+              realname TEXT DEFAULT '')`,
+		}
+		for _, stmt := range stmts {
+			if _, err := tx.Exec(stmt); err != nil {
+				return err
+			}
+		}
+		return nil
+	}},
+	{6, "add whowas sign-off time, server and ip", func(tx *sql.Tx) error {
+		return addColumns(tx, "whowas", []columnDecl{
+			{"ip", "TEXT DEFAULT ''"},
+			{"server_name", "TEXT DEFAULT ''"},
+			{"sign_off_time", "INTEGER DEFAULT 0"},
+		})
+	}},
+	{7, "key channels by casefolded name", func(tx *sql.Tx) error {
+		err := addColumns(tx, "channel", []columnDecl{
+			{"name_key", "TEXT DEFAULT ''"},
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(createCaseMappingTable); err != nil {
+			return err
+		}
+		return refoldChannelNames(tx, CurrentCaseMapping())
+	}},
+	{8, "move the quiet list from Q to q", func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+            UPDATE channel_mask SET mode = 'q' WHERE mode = 'Q'`)
+		return err
+	}},
+	{9, "key accounts by casefolded name", func(tx *sql.Tx) error {
+		err := addColumns(tx, "account", []columnDecl{
+			{"name_key", "TEXT DEFAULT ''"},
+		})
+		if err != nil {
+			return err
+		}
+		return refoldAccountNames(tx, CurrentCaseMapping())
+	}},
+}
+
+const (
+	createChannelMaskTable = `
+        CREATE TABLE IF NOT EXISTS channel_mask (
+          channel TEXT NOT NULL,
+          mode TEXT NOT NULL,
+          mask TEXT NOT NULL,
+          set_by TEXT DEFAULT '',
+          set_time INTEGER DEFAULT 0,
+          expires INTEGER DEFAULT 0,
+          UNIQUE (channel, mode, mask) ON CONFLICT REPLACE)`
+
+	// the casemapping that channel.name_key, channel_mask.channel and
+	// account.name_key were folded with
+	createCaseMappingTable = `
+        CREATE TABLE IF NOT EXISTS casemapping (
+          name TEXT NOT NULL)`
+
+	createSchemaVersionTable = `
+        CREATE TABLE IF NOT EXISTS schema_version (
+          version INTEGER NOT NULL UNIQUE,
+          applied_time INTEGER DEFAULT 0)`
+)
+
+// mask list columns of the channel table, replaced by channel_mask
+var channelMaskColumns = map[string]ChannelMode{
+	"ban_list":    BanMask,
+	"except_list": ExceptMask,
+	"invite_list": InviteMask,
+	"quiet_list":  QuietMask,
+}
+
+func LatestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+// InitDB creates a new database with the latest schema. It won't replace
+// an existing database unless `force` is set.
+func InitDB(path string, force bool) {
+	if _, err := os.Stat(path); err == nil {
+		if !force {
+			log.Fatalf("initdb error: %s exists; use -force to overwrite it", path)
+		}
+		if err := os.Remove(path); err != nil {
+			log.Fatal("initdb error: ", err)
+		}
+	}
+
 	db := OpenDB(path)
 	defer db.Close()
-	_, err := db.Exec(`
-        CREATE TABLE channel (
-          name TEXT NOT NULL UNIQUE,
-          flags TEXT DEFAULT '',
-          key TEXT DEFAULT '',
-          topic TEXT DEFAULT '',
-          user_limit INTEGER DEFAULT 0,
-          ban_list TEXT DEFAULT '',
-          except_list TEXT DEFAULT '',
-          invite_list TEXT DEFAULT '')`)
-	if err != nil {
+	if err := MigrateDB(db); err != nil {
 		log.Fatal("initdb error: ", err)
 	}
 }
 
-func UpgradeDB(path string) {
+// MigrateDB applies every migration newer than the database's schema
+// version.
+func MigrateDB(db *sql.DB) error {
+	if _, err := db.Exec(createSchemaVersionTable); err != nil {
+		return err
+	}
+
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+
+	for _, migration := range migrations {
+		if migration.version <= version {
+			continue
+		}
+		if err := applyMigration(db, migration); err != nil {
+			return fmt.Errorf("migration %s: %s", migration, err)
+		}
+		log.Println("applied migration", migration)
+	}
+
+	mapping, err := StoredCaseMapping(db)
+	if err != nil {
+		return err
+	}
+	if mapping != CurrentCaseMapping() {
+		err := inTransaction(db, func(tx *sql.Tx) error {
+			if err := refoldAccountNames(tx, CurrentCaseMapping()); err != nil {
+				return err
+			}
+			return refoldChannelNames(tx, CurrentCaseMapping())
+		})
+		if err != nil {
+			return fmt.Errorf("casemapping %s: %s", CurrentCaseMapping(), err)
+		}
+		log.Printf("refolded channel and account names from casemapping %s to %s",
+			mapping, CurrentCaseMapping())
+	}
+	return nil
+}
+
+// inTransaction runs `f` in a transaction that is committed if `f`
+// succeeds and rolled back otherwise.
+func inTransaction(db *sql.DB, f func(*sql.Tx) error) (err error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	err = f(tx)
+	return
+}
+
+func applyMigration(db *sql.DB, migration *Migration) error {
+	return inTransaction(db, func(tx *sql.Tx) error {
+		if err := migration.apply(tx); err != nil {
+			return err
+		}
+		_, err := tx.Exec(`
+            INSERT INTO schema_version (version, applied_time) VALUES (?, ?)`,
+			migration.version, time.Now().Unix())
+		return err
+	})
+}
+
+// StoredCaseMapping is the casemapping the database's channel names were
+// folded with, or "" if they haven't been.
+func StoredCaseMapping(db queryer) (mapping CaseMapping, err error) {
+	exists, err := hasTable(db, "casemapping")
+	if err != nil || !exists {
+		return
+	}
+
+	rows, err := db.Query(`SELECT name FROM casemapping`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	if rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return
+		}
+		mapping = CaseMapping(name)
+	}
+	err = rows.Err()
+	return
+}
+
+// SchemaVersion is the newest migration applied to the database, or 0 if
+// it predates schema_version.
+func SchemaVersion(db *sql.DB) (version int, err error) {
+	exists, err := hasTable(db, "schema_version")
+	if err != nil || !exists {
+		return
+	}
+
+	var max sql.NullInt64
+	err = db.QueryRow(`SELECT MAX(version) FROM schema_version`).Scan(&max)
+	version = int(max.Int64)
+	return
+}
+
+// CheckDB stops the server if the database schema isn't up to date.
+func CheckDB(db *sql.DB) {
+	version, err := SchemaVersion(db)
+	if err != nil {
+		log.Fatal("database error: ", err)
+	}
+	latest := LatestSchemaVersion()
+	if version < latest {
+		log.Fatalf("database schema version %d is older than %d; "+
+			"run `ergonomadic migrate`", version, latest)
+	}
+	if version > latest {
+		log.Fatalf("database schema version %d is newer than this server "+
+			"supports (%d)", version, latest)
+	}
+
+	mapping, err := StoredCaseMapping(db)
+	if err != nil {
+		log.Fatal("database error: ", err)
+	}
+	if mapping != CurrentCaseMapping() {
+		log.Fatalf("database names use casemapping %s, not %s; "+
+			"run `ergonomadic migrate`", mapping, CurrentCaseMapping())
+	}
+}
+
+// MigrationStatus describes the schema version of the database at `path`
+// and every migration, applied or pending.
+func MigrationStatus(path string) (lines []string, err error) {
 	db := OpenDB(path)
-	alter := `ALTER TABLE channel ADD COLUMN %s TEXT DEFAULT ''`
-	cols := []string{"ban_list", "except_list", "invite_list"}
-	for _, col := range cols {
-		_, err := db.Exec(fmt.Sprintf(alter, col))
+	defer db.Close()
+
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return
+	}
+	lines = append(lines, fmt.Sprintf("schema version %d of %d",
+		version, LatestSchemaVersion()))
+
+	mapping, err := StoredCaseMapping(db)
+	if err != nil {
+		return
+	}
+	lines = append(lines, fmt.Sprintf("casemapping %s (configured %s)",
+		mapping, CurrentCaseMapping()))
+
+	applied := make(map[int]time.Time)
+	if version > 0 {
+		var rows *sql.Rows
+		rows, err = db.Query(`SELECT version, applied_time FROM schema_version`)
 		if err != nil {
-			log.Fatal("updatedb error: ", err)
+			return
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var number int
+			var appliedTime int64
+			if err = rows.Scan(&number, &appliedTime); err != nil {
+				return
+			}
+			applied[number] = fromUnixTime(appliedTime)
 		}
 	}
+
+	for _, migration := range migrations {
+		state := "pending"
+		if appliedTime, ok := applied[migration.version]; ok {
+			state = "applied " + appliedTime.Format(time.RFC1123)
+		}
+		lines = append(lines, fmt.Sprintf("  %s (%s)", migration, state))
+	}
+	return
+}
+
+// migrateChannelMasks copies the old mask list columns into channel_mask
+// and then empties them.
+func migrateChannelMasks(tx *sql.Tx, existing map[string]bool) (err error) {
+	for column, mode := range channelMaskColumns {
+		if !existing[column] {
+			continue
+		}
+
+		var rows *sql.Rows
+		rows, err = tx.Query(fmt.Sprintf(
+			`SELECT name, %s FROM channel WHERE %s != ''`, column, column))
+		if err != nil {
+			return
+		}
+		lists := make(map[string]string)
+		for rows.Next() {
+			var name, list string
+			if err = rows.Scan(&name, &list); err != nil {
+				rows.Close()
+				return
+			}
+			lists[name] = list
+		}
+		rows.Close()
+
+		for name, list := range lists {
+			for _, mask := range strings.Fields(list) {
+				_, err = tx.Exec(`
+                    INSERT INTO channel_mask (channel, mode, mask)
+                      VALUES (?, ?, ?)`, name, mode.String(), mask)
+				if err != nil {
+					return
+				}
+			}
+		}
+
+		_, err = tx.Exec(fmt.Sprintf(`UPDATE channel SET %s = ''`, column))
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// refoldChannelNames recomputes channel.name_key and re-keys channel_mask
+// with `mapping`, failing if two channels become the same channel. Mask
+// lists of channels that no longer exist are dropped.
+func refoldChannelNames(tx *sql.Tx, mapping CaseMapping) (err error) {
+	// keys may move onto each other's old values before they are all unique
+	// again
+	if _, err = tx.Exec(`DROP INDEX IF EXISTS channel_name_key`); err != nil {
+		return
+	}
+
+	rows, err := tx.Query(`SELECT name, name_key FROM channel`)
+	if err != nil {
+		return
+	}
+	newKeys := make(map[string]string) // old key -> new key
+	names := make(map[string]string)   // new key -> name
+	for rows.Next() {
+		var name, oldKey string
+		if err = rows.Scan(&name, &oldKey); err != nil {
+			rows.Close()
+			return
+		}
+		if oldKey == "" {
+			// masks were keyed by the channel's name before name_key
+			oldKey = name
+		}
+		key := mapping.Fold(name)
+		if other, ok := names[key]; ok {
+			rows.Close()
+			return fmt.Errorf("channels %s and %s are the same channel", other, name)
+		}
+		names[key] = name
+		newKeys[oldKey] = key
+	}
+	rows.Close()
+
+	for key, name := range names {
+		_, err = tx.Exec(`UPDATE channel SET name_key = ? WHERE name = ?`, key, name)
+		if err != nil {
+			return
+		}
+	}
+
+	if err = refoldChannelMasks(tx, newKeys); err != nil {
+		return
+	}
+
+	_, err = tx.Exec(`
+        CREATE UNIQUE INDEX IF NOT EXISTS channel_name_key ON channel (name_key)`)
+	if err != nil {
+		return
+	}
+	if _, err = tx.Exec(`DELETE FROM casemapping`); err != nil {
+		return
+	}
+	_, err = tx.Exec(`INSERT INTO casemapping (name) VALUES (?)`, mapping.String())
+	return
+}
+
+// refoldAccountNames recomputes account.name_key with `mapping`. The
+// casemapping table is updated by refoldChannelNames.
+func refoldAccountNames(tx *sql.Tx, mapping CaseMapping) (err error) {
+	if _, err = tx.Exec(`DROP INDEX IF EXISTS account_name_key`); err != nil {
+		return
+	}
+
+	rows, err := tx.Query(`SELECT name FROM account`)
+	if err != nil {
+		return
+	}
+	names := make(map[string]string) // key -> name
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			rows.Close()
+			return
+		}
+		key := mapping.Fold(name)
+		if other, ok := names[key]; ok {
+			rows.Close()
+			return fmt.Errorf("accounts %s and %s are the same account", other, name)
+		}
+		names[key] = name
+	}
+	rows.Close()
+
+	for key, name := range names {
+		_, err = tx.Exec(`UPDATE account SET name_key = ? WHERE name = ?`, key, name)
+		if err != nil {
+			return
+		}
+	}
+
+	_, err = tx.Exec(`
+        CREATE UNIQUE INDEX IF NOT EXISTS account_name_key ON account (name_key)`)
+	return
+}
+
+func refoldChannelMasks(tx *sql.Tx, newKeys map[string]string) (err error) {
+	type maskRow struct {
+		channel, mode, mask, setBy string
+		setTime, expires           int64
+	}
+
+	rows, err := tx.Query(`
+        SELECT channel, mode, mask, set_by, set_time, expires FROM channel_mask`)
+	if err != nil {
+		return
+	}
+	masks := make([]*maskRow, 0)
+	for rows.Next() {
+		row := &maskRow{}
+		err = rows.Scan(&row.channel, &row.mode, &row.mask, &row.setBy,
+			&row.setTime, &row.expires)
+		if err != nil {
+			rows.Close()
+			return
+		}
+		masks = append(masks, row)
+	}
+	rows.Close()
+
+	if _, err = tx.Exec(`DELETE FROM channel_mask`); err != nil {
+		return
+	}
+	for _, row := range masks {
+		key, ok := newKeys[row.channel]
+		if !ok {
+			continue
+		}
+		_, err = tx.Exec(`
+            INSERT INTO channel_mask
+              (channel, mode, mask, set_by, set_time, expires)
+              VALUES (?, ?, ?, ?, ?, ?)`,
+			key, row.mode, row.mask, row.setBy, row.setTime, row.expires)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+type columnDecl struct {
+	name string
+	decl string
+}
+
+// addColumns adds any of `columns` that `table` doesn't have yet.
+func addColumns(tx *sql.Tx, table string, columns []columnDecl) error {
+	existing, err := tableColumns(tx, table)
+	if err != nil {
+		return err
+	}
+	for _, column := range columns {
+		if existing[column.name] {
+			continue
+		}
+		_, err := tx.Exec(fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`,
+			table, column.name, column.decl))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// queryer is a *sql.DB or *sql.Tx.
+type queryer interface {
+	Query(string, ...interface{}) (*sql.Rows, error)
+}
+
+func hasTable(db queryer, table string) (exists bool, err error) {
+	rows, err := db.Query(`
+        SELECT name FROM sqlite_master WHERE type = 'table' AND name = ?`,
+		table)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+	exists = rows.Next()
+	err = rows.Err()
+	return
+}
+
+func tableColumns(db queryer, table string) (columns map[string]bool, err error) {
+	rows, err := db.Query(fmt.Sprintf(`PRAGMA table_info(%s)`, table))
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	columns = make(map[string]bool)
+	for rows.Next() {
+		var cid int
+		var name, ctype string
+		var notNull, pk int
+		var defaultValue sql.NullString
+		err = rows.Scan(&cid, &name, &ctype, &notNull, &defaultValue, &pk)
+		if err != nil {
+			return
+		}
+		columns[name] = true
+	}
+	err = rows.Err()
+	return
 }
 
 func OpenDB(path string) *sql.DB {
@@ -46,3 +615,18 @@ func OpenDB(path string) *sql.DB {
 	}
 	return db
 }
+
+// Times are stored as unix seconds, with 0 for the zero time.
+func unixTime(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+func fromUnixTime(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+	return time.Unix(seconds, 0)
+}
@@ -0,0 +1,163 @@
+package irc
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestDBPath returns a path for a database in a directory that the
+// returned function removes.
+func newTestDBPath(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "ergonomadic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return filepath.Join(dir, "ergonomadic.db"), func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func queryStrings(t *testing.T, db *sql.DB, query string) (strs []string) {
+	rows, err := db.Query(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var str string
+		if err := rows.Scan(&str); err != nil {
+			t.Fatal(err)
+		}
+		strs = append(strs, str)
+	}
+	return
+}
+
+func TestMigrateDBFromFirstSchema(t *testing.T) {
+	path, cleanup := newTestDBPath(t)
+	defer cleanup()
+
+	// the schema from before schema_version existed
+	db := OpenDB(path)
+	defer db.Close()
+	stmts := []string{`
+        CREATE TABLE channel (
+          name TEXT NOT NULL UNIQUE,
+          flags TEXT DEFAULT '',
+          key TEXT DEFAULT '',
+          topic TEXT DEFAULT '',
+          user_limit INTEGER DEFAULT 0,
+          ban_list TEXT DEFAULT '',
+          except_list TEXT DEFAULT '',
+          invite_list TEXT DEFAULT '')`, `
+        INSERT INTO channel (name, flags, topic, ban_list, except_list)
+          VALUES ('#Chan', 'Pt', 'old', '*!*@a.example.com *!*@b.example.com',
+            'dan!*@*')`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := MigrateDB(db); err != nil {
+		t.Fatal("migrate: ", err)
+	}
+	if version, _ := SchemaVersion(db); version != LatestSchemaVersion() {
+		t.Errorf("schema version %d, want %d", version, LatestSchemaVersion())
+	}
+	if mapping, _ := StoredCaseMapping(db); mapping != CurrentCaseMapping() {
+		t.Errorf("casemapping %q, want %q", mapping, CurrentCaseMapping())
+	}
+	if keys := queryStrings(t, db, `SELECT name_key FROM channel`); (len(keys) != 1) || (keys[0] != "#chan") {
+		t.Errorf("name keys = %v", keys)
+	}
+	if lists := queryStrings(t, db, `SELECT ban_list || except_list FROM channel`); lists[0] != "" {
+		t.Errorf("old mask lists weren't emptied: %q", lists[0])
+	}
+
+	// migrating an up-to-date database changes nothing
+	if err := MigrateDB(db); err != nil {
+		t.Fatal("migrate again: ", err)
+	}
+
+	store := NewSQLiteStore(path)
+	defer store.Close()
+	records, err := store.Channels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 {
+		t.Fatalf("%d channels, want 1", len(records))
+	}
+	record := records[0]
+	if (record.name != "#Chan") || (record.topic != "old") || (record.flags.String() != "Pt") {
+		t.Errorf("channel = %+v", record)
+	}
+	if (len(record.masks[BanMask]) != 2) || (len(record.masks[ExceptMask]) != 1) {
+		t.Errorf("masks = %v", record.masks)
+	}
+}
+
+func TestMigrateDBCaseMapping(t *testing.T) {
+	defer SetCaseMapping(CurrentCaseMapping())
+	path, cleanup := newTestDBPath(t)
+	defer cleanup()
+
+	SetCaseMapping(CaseMappingRFC1459)
+	InitDB(path, false)
+	store := NewSQLiteStore(path)
+	err := store.SaveChannel(&ChannelRecord{
+		name: "#[Chan]",
+		masks: map[ChannelMode][]*UserMask{
+			BanMask: {{mask: "*!*@example.com"}},
+		},
+	})
+	if err == nil {
+		err = store.SaveAccount(&AccountRecord{name: "[Dan]"})
+	}
+	store.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	SetCaseMapping(CaseMappingASCII)
+	db := OpenDB(path)
+	defer db.Close()
+	if err := MigrateDB(db); err != nil {
+		t.Fatal("migrate: ", err)
+	}
+	if mapping, _ := StoredCaseMapping(db); mapping != CaseMappingASCII {
+		t.Errorf("casemapping %q, want ascii", mapping)
+	}
+	tests := []struct {
+		query string
+		key   string
+	}{
+		{`SELECT name_key FROM channel`, "#[chan]"},
+		{`SELECT channel FROM channel_mask`, "#[chan]"},
+		{`SELECT name_key FROM account`, "[dan]"},
+	}
+	for _, test := range tests {
+		if keys := queryStrings(t, db, test.query); (len(keys) != 1) || (keys[0] != test.key) {
+			t.Errorf("%s = %v, want %s", test.query, keys, test.key)
+		}
+	}
+
+	// names that are distinct in ascii collide in rfc1459
+	_, err = db.Exec(`
+        INSERT INTO channel (name, name_key) VALUES ('#{chan}', '#{chan}')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetCaseMapping(CaseMappingRFC1459)
+	if err := MigrateDB(db); err == nil {
+		t.Error("refolded two channels onto one name")
+	}
+	if mapping, _ := StoredCaseMapping(db); mapping != CaseMappingASCII {
+		t.Errorf("a failed refold changed the casemapping to %q", mapping)
+	}
+}
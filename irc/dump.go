@@ -0,0 +1,431 @@
+package irc
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// DUMP_VERSION is the version of the JSON dump format written by
+// `ergonomadic dbexport` and read by `ergonomadic dbimport`. Bump it for any
+// change that older versions can't read.
+//
+// Version 1 looks like this. Times are unix seconds, 0 meaning unset, and
+// password hashes are base64-encoded bcrypt hashes.
+//
+//	{
+//	  "version": 1,
+//	  "channels": [{
+//	    "name": "#chan",
+//	    "flags": "Pnt",
+//	    "key": "",
+//	    "topic": "welcome",
+//	    "topic_set_by": "nick!user@host",
+//	    "topic_time": 1400000000,
+//	    "created_time": 1400000000,
+//	    "user_limit": 0,
+//	    "join_throttle": "5:10",
+//	    "forward": "#overflow",
+//	    "masks": {
+//	      "b": [{"mask": "*!*@spam.example.com", "set_by": "nick!user@host",
+//	             "set_time": 1400000000, "expires": 0}]
+//	    }
+//	  }],
+//	  "accounts": [{"name": "nick", "password_hash": "...", "created_time": 0}],
+//	  "bans": [{"mask": "*!*@spam.example.com", "reason": "spam",
+//	            "set_by": "oper", "set_time": 1400000000}]
+//	}
+const (
+	DUMP_VERSION = 1
+)
+
+type Dump struct {
+	Version  int            `json:"version"`
+	Channels []*ChannelDump `json:"channels"`
+	Accounts []*AccountDump `json:"accounts"`
+	Bans     []*BanDump     `json:"bans"`
+}
+
+type ChannelDump struct {
+	Name         string                 `json:"name"`
+	Flags        string                 `json:"flags"`
+	Key          string                 `json:"key"`
+	Topic        string                 `json:"topic"`
+	TopicSetBy   string                 `json:"topic_set_by"`
+	TopicTime    int64                  `json:"topic_time"`
+	CreatedTime  int64                  `json:"created_time"`
+	UserLimit    uint64                 `json:"user_limit"`
+	JoinThrottle string                 `json:"join_throttle"`
+	Forward      string                 `json:"forward"`
+	Masks        map[string][]*MaskDump `json:"masks"`
+}
+
+type MaskDump struct {
+	Mask    string `json:"mask"`
+	SetBy   string `json:"set_by"`
+	SetTime int64  `json:"set_time"`
+	Expires int64  `json:"expires"`
+}
+
+type AccountDump struct {
+	Name         string `json:"name"`
+	PasswordHash []byte `json:"password_hash"`
+	CreatedTime  int64  `json:"created_time"`
+}
+
+type BanDump struct {
+	Mask    string `json:"mask"`
+	Reason  string `json:"reason"`
+	SetBy   string `json:"set_by"`
+	SetTime int64  `json:"set_time"`
+}
+
+// ExportDB writes everything in `store` as JSON to `out`.
+func ExportDB(store Store, out io.Writer) error {
+	dump := &Dump{
+		Version:  DUMP_VERSION,
+		Channels: make([]*ChannelDump, 0),
+		Accounts: make([]*AccountDump, 0),
+		Bans:     make([]*BanDump, 0),
+	}
+
+	channels, err := store.Channels()
+	if err != nil {
+		return err
+	}
+	for _, record := range channels {
+		dump.Channels = append(dump.Channels, channelDump(record))
+	}
+	sort.Sort(channelDumpsByName(dump.Channels))
+
+	accounts, err := store.Accounts()
+	if err != nil {
+		return err
+	}
+	for _, record := range accounts {
+		dump.Accounts = append(dump.Accounts, &AccountDump{
+			Name:         record.name.String(),
+			PasswordHash: record.passwordHash,
+			CreatedTime:  unixTime(record.ctime),
+		})
+	}
+	sort.Sort(accountDumpsByName(dump.Accounts))
+
+	bans, err := store.Bans()
+	if err != nil {
+		return err
+	}
+	for _, record := range bans {
+		dump.Bans = append(dump.Bans, &BanDump{
+			Mask:    record.mask.String(),
+			Reason:  record.reason.String(),
+			SetBy:   record.setBy.String(),
+			SetTime: unixTime(record.setTime),
+		})
+	}
+	sort.Sort(banDumpsByMask(dump.Bans))
+
+	bytes, err := json.MarshalIndent(dump, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, string(bytes))
+	return err
+}
+
+func channelDump(record *ChannelRecord) *ChannelDump {
+	channel := &ChannelDump{
+		Name:         record.name.String(),
+		Flags:        record.flags.String(),
+		Key:          record.key.String(),
+		Topic:        record.topic.String(),
+		TopicSetBy:   record.topicSetBy.String(),
+		TopicTime:    unixTime(record.topicTime),
+		CreatedTime:  unixTime(record.ctime),
+		UserLimit:    record.userLimit,
+		JoinThrottle: record.joinThrottle,
+		Forward:      record.forward.String(),
+		Masks:        make(map[string][]*MaskDump),
+	}
+	for mode, masks := range record.masks {
+		for _, mask := range masks {
+			channel.Masks[mode.String()] = append(channel.Masks[mode.String()],
+				&MaskDump{
+					Mask:    mask.mask.String(),
+					SetBy:   mask.setBy.String(),
+					SetTime: unixTime(mask.setTime),
+					Expires: unixTime(mask.expires),
+				})
+		}
+	}
+	for _, masks := range channel.Masks {
+		sort.Sort(maskDumpsByTime(masks))
+	}
+	return channel
+}
+
+type channelDumpsByName []*ChannelDump
+
+func (dumps channelDumpsByName) Len() int {
+	return len(dumps)
+}
+
+func (dumps channelDumpsByName) Less(i, j int) bool {
+	return dumps[i].Name < dumps[j].Name
+}
+
+func (dumps channelDumpsByName) Swap(i, j int) {
+	dumps[i], dumps[j] = dumps[j], dumps[i]
+}
+
+type maskDumpsByTime []*MaskDump
+
+func (dumps maskDumpsByTime) Len() int {
+	return len(dumps)
+}
+
+func (dumps maskDumpsByTime) Less(i, j int) bool {
+	if dumps[i].SetTime != dumps[j].SetTime {
+		return dumps[i].SetTime < dumps[j].SetTime
+	}
+	return dumps[i].Mask < dumps[j].Mask
+}
+
+func (dumps maskDumpsByTime) Swap(i, j int) {
+	dumps[i], dumps[j] = dumps[j], dumps[i]
+}
+
+type accountDumpsByName []*AccountDump
+
+func (dumps accountDumpsByName) Len() int {
+	return len(dumps)
+}
+
+func (dumps accountDumpsByName) Less(i, j int) bool {
+	return dumps[i].Name < dumps[j].Name
+}
+
+func (dumps accountDumpsByName) Swap(i, j int) {
+	dumps[i], dumps[j] = dumps[j], dumps[i]
+}
+
+type banDumpsByMask []*BanDump
+
+func (dumps banDumpsByMask) Len() int {
+	return len(dumps)
+}
+
+func (dumps banDumpsByMask) Less(i, j int) bool {
+	return dumps[i].Mask < dumps[j].Mask
+}
+
+func (dumps banDumpsByMask) Swap(i, j int) {
+	dumps[i], dumps[j] = dumps[j], dumps[i]
+}
+
+// ImportDB reads a dump written by ExportDB into `store`. Nothing is
+// written unless the whole dump is valid, and then all of it is written at
+// once. Channels, accounts and bans that already exist are conflicts,
+// unless `merge` is set, in which case they are replaced. Channel and
+// account names are compared casefolded, so merging "Nick" replaces
+// "nick".
+func ImportDB(store Store, in io.Reader, merge bool) error {
+	dump := &Dump{}
+	if err := json.NewDecoder(in).Decode(dump); err != nil {
+		return err
+	}
+	if dump.Version != DUMP_VERSION {
+		return fmt.Errorf("unsupported dump version %d (want %d)",
+			dump.Version, DUMP_VERSION)
+	}
+
+	channels, err := dump.channelRecords()
+	if err != nil {
+		return err
+	}
+	accounts, err := dump.accountRecords()
+	if err != nil {
+		return err
+	}
+	bans, err := dump.banRecords()
+	if err != nil {
+		return err
+	}
+
+	if !merge {
+		if err := checkImportConflicts(store, channels, accounts, bans); err != nil {
+			return err
+		}
+	}
+
+	return store.Import(channels, accounts, bans)
+}
+
+func (dump *Dump) channelRecords() ([]*ChannelRecord, error) {
+	records := make([]*ChannelRecord, 0, len(dump.Channels))
+	seen := make(map[Name]bool)
+	for _, channel := range dump.Channels {
+		name := NewName(channel.Name)
+		if !name.IsChannel() {
+			return nil, fmt.Errorf("invalid channel name: %s", channel.Name)
+		}
+		if seen[name.ToLower()] {
+			return nil, fmt.Errorf("duplicate channel: %s", name)
+		}
+		seen[name.ToLower()] = true
+
+		record := &ChannelRecord{
+			ctime:        fromUnixTime(channel.CreatedTime),
+			flags:        make(ChannelModes, 0, len(channel.Flags)),
+			forward:      NewName(channel.Forward),
+			joinThrottle: channel.JoinThrottle,
+			key:          NewText(channel.Key),
+			masks:        make(map[ChannelMode][]*UserMask),
+			name:         name,
+			topic:        NewText(channel.Topic),
+			topicSetBy:   NewName(channel.TopicSetBy),
+			topicTime:    fromUnixTime(channel.TopicTime),
+			userLimit:    channel.UserLimit,
+		}
+
+		for _, flag := range channel.Flags {
+			spec := LookupChannelMode(ChannelMode(flag))
+			if (spec == nil) || (spec.kind != ChannelModeFlag) {
+				return nil, fmt.Errorf("%s: invalid flag: %c", name, flag)
+			}
+			record.flags = append(record.flags, ChannelMode(flag))
+		}
+		if (record.forward != "") && !record.forward.IsChannel() {
+			return nil, fmt.Errorf("%s: invalid forward: %s", name, record.forward)
+		}
+		if record.joinThrottle != "" {
+			if _, err := ParseThrottle(record.joinThrottle); err != nil {
+				return nil, fmt.Errorf("%s: invalid join throttle: %s", name,
+					record.joinThrottle)
+			}
+		}
+
+		for modeStr, masks := range channel.Masks {
+			modes := []rune(modeStr)
+			if len(modes) != 1 {
+				return nil, fmt.Errorf("%s: invalid mask list: %s", name, modeStr)
+			}
+			mode := ChannelMode(modes[0])
+			spec := LookupChannelMode(mode)
+			if (spec == nil) || (spec.kind != ChannelModeList) {
+				return nil, fmt.Errorf("%s: invalid mask list: %s", name, modeStr)
+			}
+			for _, mask := range masks {
+				if strings.TrimSpace(mask.Mask) == "" {
+					return nil, fmt.Errorf("%s: empty %s mask", name, mode)
+				}
+				maskName := NewName(mask.Mask)
+				if IsExtBan(maskName) && (ParseExtBan(maskName) == nil) {
+					return nil, fmt.Errorf("%s: invalid %s mask: %s", name, mode,
+						mask.Mask)
+				}
+				record.masks[mode] = append(record.masks[mode], &UserMask{
+					mask:    maskName,
+					setBy:   NewName(mask.SetBy),
+					setTime: fromUnixTime(mask.SetTime),
+					expires: fromUnixTime(mask.Expires),
+				})
+			}
+		}
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (dump *Dump) accountRecords() ([]*AccountRecord, error) {
+	records := make([]*AccountRecord, 0, len(dump.Accounts))
+	seen := make(map[Name]bool)
+	for _, account := range dump.Accounts {
+		name := NewName(account.Name)
+		if !name.IsNickname() {
+			return nil, fmt.Errorf("invalid account name: %s", account.Name)
+		}
+		if seen[name.ToLower()] {
+			return nil, fmt.Errorf("duplicate account: %s", name)
+		}
+		seen[name.ToLower()] = true
+
+		records = append(records, &AccountRecord{
+			ctime:        fromUnixTime(account.CreatedTime),
+			name:         name,
+			passwordHash: account.PasswordHash,
+		})
+	}
+	return records, nil
+}
+
+func (dump *Dump) banRecords() ([]*BanRecord, error) {
+	records := make([]*BanRecord, 0, len(dump.Bans))
+	seen := make(map[Name]bool)
+	for _, ban := range dump.Bans {
+		mask := NewName(ban.Mask)
+		if strings.TrimSpace(ban.Mask) == "" {
+			return nil, fmt.Errorf("empty ban mask")
+		}
+		if seen[mask.ToLower()] {
+			return nil, fmt.Errorf("duplicate ban: %s", mask)
+		}
+		seen[mask.ToLower()] = true
+
+		records = append(records, &BanRecord{
+			mask:    mask,
+			reason:  NewText(ban.Reason),
+			setBy:   NewName(ban.SetBy),
+			setTime: fromUnixTime(ban.SetTime),
+		})
+	}
+	return records, nil
+}
+
+func checkImportConflicts(store Store, channels []*ChannelRecord,
+	accounts []*AccountRecord, bans []*BanRecord) error {
+	existingChannels, err := store.Channels()
+	if err != nil {
+		return err
+	}
+	names := make(map[Name]bool)
+	for _, record := range existingChannels {
+		names[record.name.ToLower()] = true
+	}
+	for _, record := range channels {
+		if names[record.name.ToLower()] {
+			return fmt.Errorf("channel %s already exists", record.name)
+		}
+	}
+
+	existingAccounts, err := store.Accounts()
+	if err != nil {
+		return err
+	}
+	accountNames := make(map[Name]bool)
+	for _, record := range existingAccounts {
+		accountNames[record.name.ToLower()] = true
+	}
+	for _, record := range accounts {
+		if accountNames[record.name.ToLower()] {
+			return fmt.Errorf("account %s already exists", record.name)
+		}
+	}
+
+	existingBans, err := store.Bans()
+	if err != nil {
+		return err
+	}
+	masks := make(map[Name]bool)
+	for _, record := range existingBans {
+		masks[record.mask.ToLower()] = true
+	}
+	for _, record := range bans {
+		if masks[record.mask.ToLower()] {
+			return fmt.Errorf("ban %s already exists", record.mask)
+		}
+	}
+	return nil
+}
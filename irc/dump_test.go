@@ -0,0 +1,142 @@
+package irc
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testDump = `{
+  "version": 1,
+  "channels": [{
+    "name": "#zebra",
+    "flags": "Pn",
+    "masks": {
+      "b": [
+        {"mask": "*!*@late.example.com", "set_time": 1400000200},
+        {"mask": "$r:*spam*", "set_time": 1400000100},
+        {"mask": "*!*@b.example.com", "set_time": 1400000100}
+      ]
+    }
+  }, {
+    "name": "#Aardvark",
+    "flags": "Pt",
+    "topic": "hello",
+    "topic_set_by": "dan!dan@example.com",
+    "topic_time": 1400000000,
+    "join_throttle": "5:10",
+    "forward": "#zebra"
+  }],
+  "accounts": [
+    {"name": "zed", "password_hash": "eA==", "created_time": 1400000000},
+    {"name": "Dan", "password_hash": "eQ==", "created_time": 1400000000}
+  ],
+  "bans": [
+    {"mask": "*!*@z.example.com", "reason": "spam"},
+    {"mask": "*!*@a.example.com", "reason": "abuse", "set_by": "oper"}
+  ]
+}`
+
+func exportTestDump(t *testing.T, store Store) string {
+	var out bytes.Buffer
+	if err := ExportDB(store, &out); err != nil {
+		t.Fatal("export: ", err)
+	}
+	return out.String()
+}
+
+func TestDumpRoundTrip(t *testing.T) {
+	memoryStore := NewMemoryStore()
+	if err := ImportDB(memoryStore, strings.NewReader(testDump), false); err != nil {
+		t.Fatal("import: ", err)
+	}
+	exported := exportTestDump(t, memoryStore)
+
+	dump := &Dump{}
+	if err := json.Unmarshal([]byte(exported), dump); err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, channel := range dump.Channels {
+		names = append(names, channel.Name)
+	}
+	for _, account := range dump.Accounts {
+		names = append(names, account.Name)
+	}
+	for _, ban := range dump.Bans {
+		names = append(names, ban.Mask)
+	}
+	for _, channel := range dump.Channels {
+		for _, mask := range channel.Masks["b"] {
+			names = append(names, mask.Mask)
+		}
+	}
+	want := []string{"#Aardvark", "#zebra", "Dan", "zed",
+		"*!*@a.example.com", "*!*@z.example.com",
+		"$r:*spam*", "*!*@b.example.com", "*!*@late.example.com"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("export order:\n got %v\nwant %v", names, want)
+	}
+
+	sqliteStore, cleanup := newTestSQLiteStore(t)
+	defer cleanup()
+	if err := ImportDB(sqliteStore, strings.NewReader(exported), false); err != nil {
+		t.Fatal("import export: ", err)
+	}
+	if reexported := exportTestDump(t, sqliteStore); reexported != exported {
+		t.Errorf("round trip changed the dump:\n%s\nbecame\n%s", exported, reexported)
+	}
+}
+
+func TestImportDBConflicts(t *testing.T) {
+	store := NewMemoryStore()
+	if err := ImportDB(store, strings.NewReader(testDump), false); err != nil {
+		t.Fatal("import: ", err)
+	}
+
+	dump := `{"version": 1, "accounts": [{"name": "DAN", "password_hash": "eg=="}]}`
+	if err := ImportDB(store, strings.NewReader(dump), false); err == nil {
+		t.Error("imported an existing account without -merge")
+	}
+	if err := ImportDB(store, strings.NewReader(dump), true); err != nil {
+		t.Fatal("merge: ", err)
+	}
+	accounts, _ := store.Accounts()
+	if len(accounts) != 2 {
+		t.Errorf("merge left %d accounts, want 2", len(accounts))
+	}
+	if account, _ := store.Account("dan"); (account == nil) || (account.name != "DAN") {
+		t.Errorf("merge didn't replace Dan: %v", account)
+	}
+}
+
+func TestImportDBInvalid(t *testing.T) {
+	tests := []struct {
+		what string
+		dump string
+	}{
+		{"version", `{"version": 2}`},
+		{"channel name", `{"version": 1, "channels": [{"name": "chan"}]}`},
+		{"duplicate channel", `{"version": 1, "channels": [{"name": "#a"}, {"name": "#A"}]}`},
+		{"flag", `{"version": 1, "channels": [{"name": "#a", "flags": "b"}]}`},
+		{"forward", `{"version": 1, "channels": [{"name": "#a", "forward": "b"}]}`},
+		{"throttle", `{"version": 1, "channels": [{"name": "#a", "join_throttle": "x"}]}`},
+		{"mask list", `{"version": 1, "channels": [{"name": "#a", "masks": {"n": []}}]}`},
+		{"empty mask", `{"version": 1, "channels": [{"name": "#a", "masks": {"b": [{"mask": " "}]}}]}`},
+		{"extban type", `{"version": 1, "channels": [{"name": "#a", "masks": {"b": [{"mask": "$z:x"}]}}]}`},
+		{"extban arg", `{"version": 1, "channels": [{"name": "#a", "masks": {"e": [{"mask": "$j:nochan"}]}}]}`},
+		{"account name", `{"version": 1, "accounts": [{"name": "a b"}]}`},
+		{"duplicate account", `{"version": 1, "accounts": [{"name": "a"}, {"name": "A"}]}`},
+		{"empty ban", `{"version": 1, "bans": [{"mask": ""}]}`},
+	}
+	for _, test := range tests {
+		store := NewMemoryStore()
+		if err := ImportDB(store, strings.NewReader(test.dump), false); err == nil {
+			t.Errorf("%s: imported %s", test.what, test.dump)
+		}
+		if channels, _ := store.Channels(); len(channels) > 0 {
+			t.Errorf("%s: imported part of an invalid dump", test.what)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package irc
+
+import (
+	"strings"
+)
+
+// Extended bans match clients by something other than their
+// nick!user@host. They look like `$<type>[:<arg>]`, and a `~` before the
+// type negates the match:
+//
+//	$a             any logged-in client
+//	$a:<mask>      clients logged in to an account matching <mask>
+//	$~a            clients that aren't logged in
+//	$r:<mask>      clients with a realname matching <mask>
+//	$j:<channel>   members of <channel>
+//	$x:<mask>      clients whose nick!user@host#realname matches <mask>
+const (
+	ExtBanPrefix = "$"
+
+	ExtBanAccount   = 'a'
+	ExtBanChannel   = 'j'
+	ExtBanFullMatch = 'x'
+	ExtBanRealname  = 'r'
+)
+
+var (
+	SupportedExtBans = []rune{ExtBanAccount, ExtBanChannel, ExtBanRealname,
+		ExtBanFullMatch}
+)
+
+type ExtBan struct {
+	kind   rune
+	negate bool
+	arg    Name
+}
+
+func IsExtBan(mask Name) bool {
+	return strings.HasPrefix(mask.String(), ExtBanPrefix)
+}
+
+// ParseExtBan returns nil if `mask` isn't a valid extended ban.
+func ParseExtBan(mask Name) *ExtBan {
+	if !IsExtBan(mask) {
+		return nil
+	}
+
+	spec, arg := mask.String()[len(ExtBanPrefix):], ""
+	if index := strings.Index(spec, ":"); index >= 0 {
+		spec, arg = spec[:index], spec[index+1:]
+	}
+
+	ban := &ExtBan{
+		arg: NewName(arg).ToLower(),
+	}
+	if strings.HasPrefix(spec, "~") {
+		ban.negate = true
+		spec = spec[1:]
+	}
+
+	kinds := []rune(spec)
+	if len(kinds) != 1 {
+		return nil
+	}
+	ban.kind = kinds[0]
+
+	switch ban.kind {
+	case ExtBanAccount:
+		return ban
+
+	case ExtBanChannel:
+		if !ban.arg.IsChannel() {
+			return nil
+		}
+		return ban
+
+	case ExtBanFullMatch, ExtBanRealname:
+		if ban.arg == "" {
+			return nil
+		}
+		return ban
+	}
+	return nil
+}
+
+func (ban *ExtBan) Match(client *Client) bool {
+	return ban.match(client) != ban.negate
+}
+
+func (ban *ExtBan) match(client *Client) bool {
+	switch ban.kind {
+	case ExtBanAccount:
+		if ban.arg == "" {
+			return client.account != ""
+		}
+		return (client.account != "") && MatchMask(ban.arg, client.account.ToLower())
+
+	case ExtBanChannel:
+		channel := client.server.channels.Get(ban.arg)
+		return (channel != nil) && channel.members.Has(client)
+
+	case ExtBanFullMatch:
+		full := client.UserHost().String() + "#" + client.realname.String()
+		return MatchMask(ban.arg, NewName(full).ToLower())
+
+	case ExtBanRealname:
+		return MatchMask(ban.arg, NewName(client.realname.String()).ToLower())
+	}
+	return false
+}
+
+// EXTBAN=$,ajrx
+func ExtBanTypes() string {
+	return ExtBanPrefix + "," + string(SupportedExtBans)
+}
@@ -0,0 +1,94 @@
+package irc
+
+import (
+	"testing"
+)
+
+func TestParseExtBan(t *testing.T) {
+	tests := []struct {
+		mask   string
+		kind   rune
+		negate bool
+		arg    Name
+	}{
+		{"$a", 'a', false, ""},
+		{"$~a", 'a', true, ""},
+		{"$a:Dan*", 'a', false, "dan*"},
+		{"$~a:dan", 'a', true, "dan"},
+		{"$j:#Chan", 'j', false, "#chan"},
+		{"$r:*Bot*", 'r', false, "*bot*"},
+		{"$x:*!*@*#*bot*", 'x', false, "*!*@*#*bot*"},
+		{"$~x:a:b", 'x', true, "a:b"},
+		// invalid
+		{"a", 0, false, ""},
+		{"$", 0, false, ""},
+		{"$z", 0, false, ""},
+		{"$ab", 0, false, ""},
+		{"$~", 0, false, ""},
+		{"$j", 0, false, ""},
+		{"$j:nochan", 0, false, ""},
+		{"$r", 0, false, ""},
+		{"$x:", 0, false, ""},
+	}
+	for _, test := range tests {
+		ban := ParseExtBan(Name(test.mask))
+		if test.kind == 0 {
+			if ban != nil {
+				t.Errorf("ParseExtBan(%q) = %+v, want nil", test.mask, ban)
+			}
+			continue
+		}
+		if ban == nil {
+			t.Errorf("ParseExtBan(%q) = nil", test.mask)
+			continue
+		}
+		if (ban.kind != test.kind) || (ban.negate != test.negate) || (ban.arg != test.arg) {
+			t.Errorf("ParseExtBan(%q) = %+v", test.mask, ban)
+		}
+	}
+}
+
+func TestExtBanMatch(t *testing.T) {
+	server := newTestServer(NewMemoryStore())
+	channel := NewChannel(server, "#chan")
+
+	dan := testClient("dan", "dan", "example.com")
+	dan.server = server
+	dan.account = "Dan"
+	dan.realname = "Dan the Bot"
+	channel.members.Add(dan)
+
+	dave := testClient("dave", "dave", "example.com")
+	dave.server = server
+	dave.realname = "Dave"
+
+	tests := []struct {
+		mask string
+		dan  bool
+		dave bool
+	}{
+		{"$a", true, false},
+		{"$~a", false, true},
+		{"$a:d*", true, false},
+		{"$a:dave", false, false},
+		{"$~a:dave", true, true},
+		{"$j:#chan", true, false},
+		{"$~j:#CHAN", false, true},
+		{"$j:#other", false, false},
+		{"$r:*bot*", true, false},
+		{"$x:dan!*@*#*", true, false},
+		{"$x:*!*@example.com#dave", false, true},
+	}
+	for _, test := range tests {
+		ban := ParseExtBan(Name(test.mask))
+		if ban == nil {
+			t.Fatalf("ParseExtBan(%q) = nil", test.mask)
+		}
+		if match := ban.Match(dan); match != test.dan {
+			t.Errorf("%s matches dan = %t, want %t", test.mask, match, test.dan)
+		}
+		if match := ban.Match(dave); match != test.dave {
+			t.Errorf("%s matches dave = %t, want %t", test.mask, match, test.dave)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package irc
+
+import (
+	"fmt"
+	"unicode/utf8"
+)
+
+// Limits are the longest names and texts clients may send. They are
+// advertised in RPL_ISUPPORT. Nicks, channel names and usernames are
+// measured in characters, and the rest in bytes. Names that are too long
+// are rejected; topics, kick reasons, away messages and usernames are
+// truncated.
+type Limits struct {
+	AwayLen    int
+	ChannelLen int
+	KickLen    int
+	NickLen    int
+	TopicLen   int
+	UserLen    int
+}
+
+var (
+	DefaultLimits = Limits{
+		AwayLen:    390,
+		ChannelLen: 64,
+		KickLen:    390,
+		NickLen:    32,
+		TopicLen:   390,
+		UserLen:    10,
+	}
+
+	limits = DefaultLimits
+)
+
+// SetLimits changes the limits for every client. Zero values are replaced
+// with the defaults.
+func SetLimits(newLimits Limits) {
+	defaultLimit(&newLimits.AwayLen, DefaultLimits.AwayLen)
+	defaultLimit(&newLimits.ChannelLen, DefaultLimits.ChannelLen)
+	defaultLimit(&newLimits.KickLen, DefaultLimits.KickLen)
+	defaultLimit(&newLimits.NickLen, DefaultLimits.NickLen)
+	defaultLimit(&newLimits.TopicLen, DefaultLimits.TopicLen)
+	defaultLimit(&newLimits.UserLen, DefaultLimits.UserLen)
+	limits = newLimits
+}
+
+func defaultLimit(limit *int, value int) {
+	if *limit <= 0 {
+		*limit = value
+	}
+}
+
+// CurrentLimits are the limits set by SetLimits.
+func CurrentLimits() Limits {
+	return limits
+}
+
+// ISupport lists the RPL_ISUPPORT tokens for the limits.
+func (limits Limits) ISupport() []string {
+	return []string{
+		fmt.Sprintf("AWAYLEN=%d", limits.AwayLen),
+		fmt.Sprintf("CHANNELLEN=%d", limits.ChannelLen),
+		fmt.Sprintf("KICKLEN=%d", limits.KickLen),
+		fmt.Sprintf("NICKLEN=%d", limits.NickLen),
+		fmt.Sprintf("TOPICLEN=%d", limits.TopicLen),
+		fmt.Sprintf("USERLEN=%d", limits.UserLen),
+	}
+}
+
+// truncateUTF8 shortens `str` to at most `length` bytes without splitting
+// a character.
+func truncateUTF8(str string, length int) string {
+	if len(str) <= length {
+		return str
+	}
+	for (length > 0) && !utf8.RuneStart(str[length]) {
+		length -= 1
+	}
+	return str[:length]
+}
+
+// splitUTF8 cuts `str` into pieces of at most `length` bytes without
+// splitting characters.
+func splitUTF8(str string, length int) []string {
+	pieces := make([]string, 0, (len(str)/length)+1)
+	for len(str) > length {
+		piece := truncateUTF8(str, length)
+		if piece == "" {
+			// a single character longer than `length`
+			_, size := utf8.DecodeRuneInString(str)
+			piece = str[:size]
+		}
+		pieces = append(pieces, piece)
+		str = str[len(piece):]
+	}
+	if (str != "") || (len(pieces) == 0) {
+		pieces = append(pieces, str)
+	}
+	return pieces
+}
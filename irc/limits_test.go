@@ -0,0 +1,58 @@
+package irc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTruncateUTF8(t *testing.T) {
+	tests := []struct {
+		str       string
+		length    int
+		truncated string
+	}{
+		{"", 0, ""},
+		{"", 5, ""},
+		{"hello", 5, "hello"},
+		{"hello", 3, "hel"},
+		{"hello", 0, ""},
+		{"héllo", 2, "h"}, // é is two bytes
+		{"héllo", 3, "hé"},
+		{"日本", 2, ""},
+		{"日本", 3, "日"},
+		{"日本", 5, "日"},
+		{"a😀", 4, "a"},
+		{"a😀", 5, "a😀"},
+	}
+	for _, test := range tests {
+		if truncated := truncateUTF8(test.str, test.length); truncated != test.truncated {
+			t.Errorf("truncateUTF8(%q, %d) = %q, want %q",
+				test.str, test.length, truncated, test.truncated)
+		}
+	}
+}
+
+func TestSplitUTF8(t *testing.T) {
+	tests := []struct {
+		str    string
+		length int
+		pieces []string
+	}{
+		{"", 3, []string{""}},
+		{"abc", 3, []string{"abc"}},
+		{"abcdefg", 3, []string{"abc", "def", "g"}},
+		{"héllo", 2, []string{"h", "é", "ll", "o"}},
+		{"日本語", 4, []string{"日", "本", "語"}},
+		{"日本語", 6, []string{"日本", "語"}},
+		// characters longer than `length` are kept whole
+		{"日本", 2, []string{"日", "本"}},
+		{"a😀b", 3, []string{"a", "😀", "b"}},
+	}
+	for _, test := range tests {
+		pieces := splitUTF8(test.str, test.length)
+		if strings.Join(pieces, "|") != strings.Join(test.pieces, "|") {
+			t.Errorf("splitUTF8(%q, %d) = %q, want %q",
+				test.str, test.length, pieces, test.pieces)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package irc
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// LIST replies stop being queued while a client's send queue holds
+	// more than this many bytes and resume once it drains.
+	LIST_SENDQ_LIMIT = 8192
+)
+
+// ListFilter selects channels for LIST using the ELIST extensions:
+//
+//	#chan      exact channel name
+//	*mask*     channel names matching a wildcard mask
+//	!*mask*    channel names not matching a wildcard mask
+//	>N, <N     more or fewer than N users
+//	C>N, C<N   created more or less than N minutes ago
+//	T>N, T<N   topic set more or less than N minutes ago
+type ListFilter struct {
+	names         []Name
+	masks         []Name
+	notMasks      []Name
+	moreUsers     int
+	fewerUsers    int
+	createdBefore time.Time
+	createdAfter  time.Time
+	topicBefore   time.Time
+	topicAfter    time.Time
+}
+
+func NewListFilter() *ListFilter {
+	return &ListFilter{
+		moreUsers:  -1,
+		fewerUsers: -1,
+	}
+}
+
+func parseListMinutes(arg string) (time.Time, error) {
+	minutes, err := strconv.ParseUint(arg, 10, 32)
+	if err != nil {
+		return time.Time{}, ErrParseCommand
+	}
+	return time.Now().Add(-time.Duration(minutes) * time.Minute), nil
+}
+
+func ParseListFilter(args []string) (filter *ListFilter, err error) {
+	filter = NewListFilter()
+	for _, arg := range args {
+		switch {
+		case arg == "":
+			continue
+
+		case strings.HasPrefix(arg, ">"), strings.HasPrefix(arg, "<"):
+			var count uint64
+			count, err = strconv.ParseUint(arg[1:], 10, 32)
+			if err != nil {
+				return nil, ErrParseCommand
+			}
+			if arg[0] == '>' {
+				filter.moreUsers = int(count)
+			} else {
+				filter.fewerUsers = int(count)
+			}
+
+		case strings.HasPrefix(arg, "C>"):
+			filter.createdBefore, err = parseListMinutes(arg[2:])
+
+		case strings.HasPrefix(arg, "C<"):
+			filter.createdAfter, err = parseListMinutes(arg[2:])
+
+		case strings.HasPrefix(arg, "T>"):
+			filter.topicBefore, err = parseListMinutes(arg[2:])
+
+		case strings.HasPrefix(arg, "T<"):
+			filter.topicAfter, err = parseListMinutes(arg[2:])
+
+		case strings.HasPrefix(arg, "!"):
+			filter.notMasks = append(filter.notMasks, NewName(arg[1:]).ToLower())
+
+		case HasWildcards(arg):
+			filter.masks = append(filter.masks, NewName(arg).ToLower())
+
+		default:
+			filter.names = append(filter.names, NewName(arg))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return
+}
+
+// Matches tests everything except exact names, which are looked up
+// directly.
+func (filter *ListFilter) Matches(channel *Channel) bool {
+	users := len(channel.members)
+	if (filter.moreUsers >= 0) && (users <= filter.moreUsers) {
+		return false
+	}
+	if (filter.fewerUsers >= 0) && (users >= filter.fewerUsers) {
+		return false
+	}
+
+	if !filter.createdBefore.IsZero() && !channel.ctime.Before(filter.createdBefore) {
+		return false
+	}
+	if !filter.createdAfter.IsZero() && !channel.ctime.After(filter.createdAfter) {
+		return false
+	}
+	if !filter.topicBefore.IsZero() && (channel.topicTime.IsZero() ||
+		!channel.topicTime.Before(filter.topicBefore)) {
+		return false
+	}
+	if !filter.topicAfter.IsZero() && (channel.topicTime.IsZero() ||
+		!channel.topicTime.After(filter.topicAfter)) {
+		return false
+	}
+
+	name := channel.name.ToLower()
+	for _, mask := range filter.notMasks {
+		if MatchMask(mask, name) {
+			return false
+		}
+	}
+	if len(filter.masks) == 0 {
+		return true
+	}
+	for _, mask := range filter.masks {
+		if MatchMask(mask, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ChannelListing holds the channels a client has yet to receive from a
+// LIST command.
+type ChannelListing struct {
+	names []Name
+}
+
+func (msg *ListCommand) HandleServer(server *Server) {
+	client := msg.Client()
+
+	// TODO target server
+	if msg.target != "" {
+		client.ErrNoSuchServer(msg.target)
+		return
+	}
+
+	listing := &ChannelListing{}
+	if len(msg.filter.names) > 0 {
+		for _, chname := range msg.filter.names {
+			channel := server.channels.Get(chname)
+			if channel == nil || !channel.IsVisibleTo(client) {
+				client.ErrNoSuchChannel(chname)
+				continue
+			}
+			if msg.filter.Matches(channel) {
+				listing.names = append(listing.names, chname)
+			}
+		}
+	} else {
+		for name, channel := range server.channels {
+			if channel.IsVisibleTo(client) && msg.filter.Matches(channel) {
+				listing.names = append(listing.names, name)
+			}
+		}
+	}
+
+	client.listing = listing
+	server.continueList(client)
+}
+
+// continueList sends LIST replies until the client's send queue is full,
+// then waits for it to drain before sending the rest.
+func (server *Server) continueList(client *Client) {
+	listing := client.listing
+	if (listing == nil) || client.hasQuit {
+		return
+	}
+
+	for len(listing.names) > 0 {
+		if client.socket.SendQ() > LIST_SENDQ_LIMIT {
+			client.socket.WhenDrained(func() {
+				// Called on the writer goroutine, which must not wait for
+				// the server goroutine.
+				go func() {
+					server.drained <- client
+				}()
+			})
+			return
+		}
+
+		channel := server.channels.Get(listing.names[0])
+		listing.names = listing.names[1:]
+		if (channel == nil) || !channel.IsVisibleTo(client) {
+			continue
+		}
+		client.RplList(channel)
+	}
+
+	client.listing = nil
+	client.RplListEnd(server)
+}
@@ -0,0 +1,98 @@
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseListFilter(t *testing.T) {
+	tests := []struct {
+		args  []string
+		valid bool
+	}{
+		{nil, true},
+		{[]string{""}, true},
+		{[]string{">5", "<10"}, true},
+		{[]string{"C>60", "C<1", "T>60", "T<1"}, true},
+		{[]string{"#chan", "*mask*", "!*not*"}, true},
+		{[]string{">"}, false},
+		{[]string{"<-1"}, false},
+		{[]string{">x"}, false},
+		{[]string{"C>"}, false},
+		{[]string{"T<1.5"}, false},
+	}
+	for _, test := range tests {
+		filter, err := ParseListFilter(test.args)
+		if test.valid && (err != nil) {
+			t.Errorf("ParseListFilter(%q): %s", test.args, err)
+		}
+		if !test.valid && (filter != nil) {
+			t.Errorf("ParseListFilter(%q) accepted an invalid filter", test.args)
+		}
+	}
+
+	filter, _ := ParseListFilter([]string{"#Chan", "*Mask*", "!*NOT*", ">5"})
+	if (len(filter.names) != 1) || (filter.names[0] != "#Chan") {
+		t.Errorf("names = %v", filter.names)
+	}
+	if (len(filter.masks) != 1) || (filter.masks[0] != "*mask*") {
+		t.Errorf("masks = %v", filter.masks)
+	}
+	if (len(filter.notMasks) != 1) || (filter.notMasks[0] != "*not*") {
+		t.Errorf("notMasks = %v", filter.notMasks)
+	}
+	if (filter.moreUsers != 5) || (filter.fewerUsers != -1) {
+		t.Errorf("users = >%d <%d", filter.moreUsers, filter.fewerUsers)
+	}
+}
+
+func TestListFilterMatches(t *testing.T) {
+	now := time.Now()
+	channel := &Channel{
+		name:      "#Chat",
+		ctime:     now.Add(-2 * time.Hour),
+		topicTime: now.Add(-10 * time.Minute),
+		members:   make(MemberSet),
+	}
+	channel.members.Add(testClient("dan", "dan", "example.com"))
+	channel.members.Add(testClient("dave", "dave", "example.com"))
+
+	tests := []struct {
+		args  []string
+		match bool
+	}{
+		{nil, true},
+		{[]string{">1"}, true},
+		{[]string{">2"}, false},
+		{[]string{"<3"}, true},
+		{[]string{"<2"}, false},
+		{[]string{"C>60"}, true},
+		{[]string{"C>180"}, false},
+		{[]string{"C<180"}, true},
+		{[]string{"C<60"}, false},
+		{[]string{"T>5"}, true},
+		{[]string{"T<5"}, false},
+		{[]string{"*CHAT"}, true},
+		{[]string{"*x*"}, false},
+		{[]string{"*x*", "#c*"}, true},
+		{[]string{"!#ch*"}, false},
+		{[]string{"!*x*"}, true},
+		{[]string{"#c*", "!*at"}, false},
+	}
+	for _, test := range tests {
+		filter, err := ParseListFilter(test.args)
+		if err != nil {
+			t.Fatalf("ParseListFilter(%q): %s", test.args, err)
+		}
+		if match := filter.Matches(channel); match != test.match {
+			t.Errorf("%q matches = %t, want %t", test.args, match, test.match)
+		}
+	}
+
+	channel.topicTime = time.Time{}
+	for _, args := range [][]string{{"T>5"}, {"T<5"}} {
+		if filter, _ := ParseListFilter(args); filter.Matches(channel) {
+			t.Errorf("%q matched a channel without a topic", args)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package irc
 
 import (
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
 )
@@ -20,17 +21,10 @@ var (
 		"warn":  2,
 		"error": 1,
 	}
-	devNull io.Writer
+	// set before Log is created below
+	devNull io.Writer = ioutil.Discard
 )
 
-func init() {
-	var err error
-	devNull, err = os.Open(os.DevNull)
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
 func NewLogger(on bool) *log.Logger {
 	return log.New(output(on), "", log.LstdFlags)
 }
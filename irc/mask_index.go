@@ -0,0 +1,250 @@
+package irc
+
+import (
+	"sort"
+	"strings"
+)
+
+// MaskIndex finds the clients matching a nick!user@host mask without
+// looking at every client. Nicks and usernames are indexed by prefix and
+// hostnames by suffix, so masks like `dan*!*@*` and `*!*@*.example.com`
+// only look at the clients that could match. Everything is casefolded.
+type MaskIndex struct {
+	entries map[*Client]*maskIndexEntry
+	nicks   *prefixIndex
+	users   *prefixIndex
+	hosts   *prefixIndex // reversed hostnames
+}
+
+type maskIndexEntry struct {
+	nick Name
+	user Name
+	host Name // reversed
+}
+
+func NewMaskIndex() *MaskIndex {
+	return &MaskIndex{
+		entries: make(map[*Client]*maskIndexEntry),
+		nicks:   newPrefixIndex(),
+		users:   newPrefixIndex(),
+		hosts:   newPrefixIndex(),
+	}
+}
+
+func reverseName(name Name) Name {
+	runes := []rune(name.String())
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return Name(runes)
+}
+
+// Add indexes `client` under its current nick, username and hostname,
+// replacing any older entry.
+func (index *MaskIndex) Add(client *Client) {
+	index.Remove(client)
+
+	username := client.username
+	if username == "" {
+		username = "*"
+	}
+	entry := &maskIndexEntry{
+		nick: client.Nick().ToLower(),
+		user: username.ToLower(),
+		host: reverseName(client.hostname.ToLower()),
+	}
+	index.entries[client] = entry
+	index.nicks.Add(entry.nick, client)
+	index.users.Add(entry.user, client)
+	index.hosts.Add(entry.host, client)
+}
+
+func (index *MaskIndex) Remove(client *Client) {
+	entry := index.entries[client]
+	if entry == nil {
+		return
+	}
+	delete(index.entries, client)
+	index.nicks.Remove(entry.nick, client)
+	index.users.Remove(entry.user, client)
+	index.hosts.Remove(entry.host, client)
+}
+
+// splitMask splits an expanded nick!user@host mask.
+func splitMask(mask Name) (nick, user, host Name) {
+	str := mask.String()
+	bang := strings.Index(str, "!")
+	at := strings.LastIndex(str, "@")
+	if (bang < 0) || (at < bang) {
+		return mask, "*", "*"
+	}
+	return Name(str[:bang]), Name(str[bang+1 : at]), Name(str[at+1:])
+}
+
+// literalPrefix is the part of a mask before its first wildcard, and
+// whether that is the whole mask.
+func literalPrefix(mask Name) (prefix Name, exact bool) {
+	str := mask.String()
+	wildcard := strings.IndexAny(str, "*?")
+	if wildcard < 0 {
+		return mask, true
+	}
+	return Name(str[:wildcard]), false
+}
+
+// candidates returns the clients that might match, using whichever part of
+// the mask narrows things down the most.
+func (index *MaskIndex) candidates(nick, user, host Name) ClientSet {
+	nickPrefix, nickExact := literalPrefix(nick)
+	userPrefix, userExact := literalPrefix(user)
+	hostSuffix, hostExact := literalPrefix(reverseName(host))
+
+	switch {
+	case nickExact:
+		return index.nicks.Exact(nickPrefix)
+	case hostExact:
+		return index.hosts.Exact(hostSuffix)
+	}
+
+	best, bestLen := index.nicks, len(nickPrefix)
+	prefix := nickPrefix
+	if len(hostSuffix) > bestLen {
+		best, bestLen, prefix = index.hosts, len(hostSuffix), hostSuffix
+	}
+	if userExact {
+		return index.users.Exact(userPrefix)
+	}
+	if len(userPrefix) > bestLen {
+		best, bestLen, prefix = index.users, len(userPrefix), userPrefix
+	}
+
+	if bestLen == 0 {
+		all := make(ClientSet)
+		for client := range index.entries {
+			all.Add(client)
+		}
+		return all
+	}
+	return best.Prefix(prefix)
+}
+
+// FindAll returns every client matching `mask`, which is expanded with
+// ExpandUserHost.
+func (index *MaskIndex) FindAll(mask Name) ClientSet {
+	mask = ExpandUserHost(mask).ToLower()
+	nick, user, host := splitMask(mask)
+
+	matches := make(ClientSet)
+	for client := range index.candidates(nick, user, host) {
+		entry := index.entries[client]
+		if MatchWildcard(nick.String(), entry.nick.String()) &&
+			MatchWildcard(user.String(), entry.user.String()) &&
+			MatchWildcard(host.String(), reverseName(entry.host).String()) {
+			matches.Add(client)
+		}
+	}
+	return matches
+}
+
+// prefixIndex maps keys to clients and keeps the keys sorted, so all the
+// keys with a given prefix are next to each other.
+type prefixIndex struct {
+	clients map[Name]ClientSet
+	keys    []Name
+}
+
+func newPrefixIndex() *prefixIndex {
+	return &prefixIndex{
+		clients: make(map[Name]ClientSet),
+	}
+}
+
+func (index *prefixIndex) search(key Name) int {
+	return sort.Search(len(index.keys), func(i int) bool {
+		return index.keys[i] >= key
+	})
+}
+
+func (index *prefixIndex) Add(key Name, client *Client) {
+	set := index.clients[key]
+	if set == nil {
+		set = make(ClientSet)
+		index.clients[key] = set
+
+		position := index.search(key)
+		index.keys = append(index.keys, "")
+		copy(index.keys[position+1:], index.keys[position:])
+		index.keys[position] = key
+	}
+	set.Add(client)
+}
+
+func (index *prefixIndex) Remove(key Name, client *Client) {
+	set := index.clients[key]
+	if set == nil {
+		return
+	}
+	set.Remove(client)
+	if len(set) > 0 {
+		return
+	}
+
+	delete(index.clients, key)
+	position := index.search(key)
+	if (position < len(index.keys)) && (index.keys[position] == key) {
+		index.keys = append(index.keys[:position], index.keys[position+1:]...)
+	}
+}
+
+func (index *prefixIndex) Exact(key Name) ClientSet {
+	matches := make(ClientSet)
+	for client := range index.clients[key] {
+		matches.Add(client)
+	}
+	return matches
+}
+
+func (index *prefixIndex) Prefix(prefix Name) ClientSet {
+	matches := make(ClientSet)
+	for position := index.search(prefix); position < len(index.keys); position += 1 {
+		key := index.keys[position]
+		if !strings.HasPrefix(key.String(), prefix.String()) {
+			break
+		}
+		for client := range index.clients[key] {
+			matches.Add(client)
+		}
+	}
+	return matches
+}
+
+// MatchWildcard matches `str` against a pattern in which `*` matches any
+// run of characters and `?` matches exactly one.
+func MatchWildcard(pattern string, str string) bool {
+	pat, runes := []rune(pattern), []rune(str)
+	p, s := 0, 0
+	star, starS := -1, 0
+	for s < len(runes) {
+		switch {
+		case (p < len(pat)) && ((pat[p] == '?') || (pat[p] == runes[s])):
+			p += 1
+			s += 1
+
+		case (p < len(pat)) && (pat[p] == '*'):
+			star, starS = p, s
+			p += 1
+
+		case star >= 0:
+			// let the last star swallow one more character
+			starS += 1
+			p, s = star+1, starS
+
+		default:
+			return false
+		}
+	}
+	for (p < len(pat)) && (pat[p] == '*') {
+		p += 1
+	}
+	return p == len(pat)
+}
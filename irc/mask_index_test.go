@@ -0,0 +1,247 @@
+package irc
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func testClient(nick, user, host string) *Client {
+	return &Client{
+		nick:     Name(nick),
+		username: Name(user),
+		hostname: Name(host),
+	}
+}
+
+func TestMatchWildcard(t *testing.T) {
+	tests := []struct {
+		pattern string
+		str     string
+		match   bool
+	}{
+		{"", "", true},
+		{"", "a", false},
+		{"*", "", true},
+		{"*", "anything", true},
+		{"?", "", false},
+		{"?", "a", true},
+		{"?", "ab", false},
+		{"abc", "abc", true},
+		{"abc", "abd", false},
+		{"a*c", "ac", true},
+		{"a*c", "abbbc", true},
+		{"a*c", "abbbd", false},
+		{"a?c", "abc", true},
+		{"a?c", "ac", false},
+		{"*.example.com", "irc.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*a*b*", "xxaxxbxx", true},
+		{"*a*b*", "xxbxxaxx", false},
+		{"a**b", "ab", true},
+		{"*?", "", false},
+		{"*?", "x", true},
+		{"d?n*!*@*", "dan!dan@host", true},
+		{"ü?", "üx", true},
+		{"??", "ü", false},
+	}
+	for _, test := range tests {
+		if match := MatchWildcard(test.pattern, test.str); match != test.match {
+			t.Errorf("MatchWildcard(%q, %q) = %t, want %t",
+				test.pattern, test.str, match, test.match)
+		}
+	}
+}
+
+func newTestMaskIndex() (*MaskIndex, map[string]*Client) {
+	clients := map[string]*Client{
+		"dan":   testClient("dan", "dan", "irc.example.com"),
+		"dave":  testClient("Dave", "dave", "host.example.com"),
+		"bob":   testClient("bob", "robert", "example.org"),
+		"alice": testClient("alice", "alice", "mail.example.org"),
+		"nouser": &Client{
+			nick:     "nouser",
+			hostname: "10.0.0.1",
+		},
+	}
+	index := NewMaskIndex()
+	for _, client := range clients {
+		index.Add(client)
+	}
+	return index, clients
+}
+
+func checkClientSet(t *testing.T, what string, set ClientSet, want ...*Client) {
+	if len(set) != len(want) {
+		t.Errorf("%s: got %d clients, want %d", what, len(set), len(want))
+	}
+	for _, client := range want {
+		if !set.Has(client) {
+			t.Errorf("%s: missing %s", what, client)
+		}
+	}
+}
+
+func TestMaskIndexCandidates(t *testing.T) {
+	index, clients := newTestMaskIndex()
+	candidates := func(mask string) ClientSet {
+		return index.candidates(splitMask(Name(mask)))
+	}
+
+	checkClientSet(t, "exact nick", candidates("dan!*@*"),
+		clients["dan"])
+	checkClientSet(t, "nick prefix", candidates("da*!*@*"),
+		clients["dan"], clients["dave"])
+	checkClientSet(t, "exact user", candidates("*!robert@*"),
+		clients["bob"])
+	checkClientSet(t, "user prefix", candidates("*!al*@*"),
+		clients["alice"])
+	checkClientSet(t, "address suffix", candidates("*!*@*.0.1"),
+		clients["nouser"])
+	checkClientSet(t, "exact host", candidates("*!*@example.org"),
+		clients["bob"])
+	checkClientSet(t, "host suffix", candidates("*!*@*.example.com"),
+		clients["dan"], clients["dave"])
+	checkClientSet(t, "wider host suffix", candidates("*!*@*example.org"),
+		clients["bob"], clients["alice"])
+	checkClientSet(t, "longest literal wins", candidates("d*!*@*.example.org"),
+		clients["alice"])
+	checkClientSet(t, "no literal", candidates("*!*@*"),
+		clients["dan"], clients["dave"], clients["bob"], clients["alice"],
+		clients["nouser"])
+}
+
+func TestMaskIndexFindAll(t *testing.T) {
+	index, clients := newTestMaskIndex()
+
+	checkClientSet(t, "nick only", index.FindAll("dave"),
+		clients["dave"])
+	checkClientSet(t, "casefolded", index.FindAll("DAVE!*@*.EXAMPLE.COM"),
+		clients["dave"])
+	checkClientSet(t, "question mark", index.FindAll("d??!*@*"),
+		clients["dan"])
+	checkClientSet(t, "candidates filtered", index.FindAll("d*!*@*.example.org"))
+	checkClientSet(t, "user and host", index.FindAll("*!*a*@*.example.*"),
+		clients["dan"], clients["dave"], clients["alice"])
+	checkClientSet(t, "missing user", index.FindAll("nouser!*@*"),
+		clients["nouser"])
+
+	index.Remove(clients["dan"])
+	checkClientSet(t, "removed", index.FindAll("*!*@*.example.com"),
+		clients["dave"])
+
+	clients["dave"].hostname = "example.net"
+	index.Add(clients["dave"])
+	checkClientSet(t, "moved", index.FindAll("*!*@*.example.com"))
+	checkClientSet(t, "moved to", index.FindAll("*!*@example.net"),
+		clients["dave"])
+}
+
+//
+// benchmarks against the sqlite lookups MaskIndex replaced
+//
+
+var likeQuoter = strings.NewReplacer(
+	`\`, `\\`,
+	`%`, `\%`,
+	`_`, `\_`,
+	`*`, `%`,
+	`?`, `_`)
+
+type sqliteClientDB struct {
+	db *sql.DB
+}
+
+func newSQLiteClientDB(b *testing.B) *sqliteClientDB {
+	db := &sqliteClientDB{
+		db: OpenDB(":memory:"),
+	}
+	stmts := []string{
+		`CREATE TABLE client (
+          nickname TEXT NOT NULL COLLATE NOCASE UNIQUE,
+          userhost TEXT NOT NULL COLLATE NOCASE,
+          UNIQUE (nickname, userhost) ON CONFLICT REPLACE)`,
+		`CREATE UNIQUE INDEX idx_nick ON client (nickname COLLATE NOCASE)`,
+		`CREATE UNIQUE INDEX idx_uh ON client (userhost COLLATE NOCASE)`,
+	}
+	for _, stmt := range stmts {
+		if _, err := db.db.Exec(stmt); err != nil {
+			b.Fatal(stmt, err)
+		}
+	}
+	return db
+}
+
+func (db *sqliteClientDB) Add(b *testing.B, client *Client) {
+	_, err := db.db.Exec(`INSERT INTO client (nickname, userhost) VALUES (?, ?)`,
+		client.Nick().String(), client.UserHost().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+}
+
+func (db *sqliteClientDB) FindAll(b *testing.B, userhost Name) []string {
+	rows, err := db.db.Query(
+		`SELECT nickname FROM client WHERE userhost LIKE ? ESCAPE '\'`,
+		likeQuoter.Replace(ExpandUserHost(userhost).String()))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer rows.Close()
+
+	nicks := make([]string, 0)
+	for rows.Next() {
+		var nick string
+		if err := rows.Scan(&nick); err != nil {
+			b.Fatal(err)
+		}
+		nicks = append(nicks, nick)
+	}
+	return nicks
+}
+
+const BENCHMARK_CLIENTS = 10000
+
+var benchmarkMasks = []Name{
+	"nick5000",
+	"nick12*!*@*",
+	"*!*@host42.example.com",
+	"*!*@*.net7.example.com",
+	"*!user3*@*",
+	"*!*@*",
+}
+
+func benchmarkClients() []*Client {
+	clients := make([]*Client, BENCHMARK_CLIENTS)
+	for i := range clients {
+		clients[i] = testClient(fmt.Sprintf("nick%d", i),
+			fmt.Sprintf("user%d", i%100),
+			fmt.Sprintf("host%d.net%d.example.com", i, i%10))
+	}
+	return clients
+}
+
+func BenchmarkSQLiteClientDBFindAll(b *testing.B) {
+	db := newSQLiteClientDB(b)
+	for _, client := range benchmarkClients() {
+		db.Add(b, client)
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i += 1 {
+		db.FindAll(b, benchmarkMasks[i%len(benchmarkMasks)])
+	}
+}
+
+func BenchmarkMaskIndexFindAll(b *testing.B) {
+	index := NewMaskIndex()
+	for _, client := range benchmarkClients() {
+		index.Add(client)
+	}
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i += 1 {
+		index.FindAll(benchmarkMasks[i%len(benchmarkMasks)])
+	}
+}
@@ -0,0 +1,171 @@
+package irc
+
+import (
+	"sync"
+)
+
+// MemoryStore is a Store that forgets everything when the process exits,
+// for tests and throwaway servers.
+type MemoryStore struct {
+	accounts map[Name]*AccountRecord
+	bans     map[Name]*BanRecord
+	channels map[Name]*ChannelRecord
+	mutex    sync.Mutex
+	whoWas   []*WhoWas
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		accounts: make(map[Name]*AccountRecord),
+		bans:     make(map[Name]*BanRecord),
+		channels: make(map[Name]*ChannelRecord),
+	}
+}
+
+func (store *MemoryStore) Channels() ([]*ChannelRecord, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	records := make([]*ChannelRecord, 0, len(store.channels))
+	for _, record := range store.channels {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (store *MemoryStore) SaveChannel(record *ChannelRecord) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.channels[record.name.ToLower()] = record
+	return nil
+}
+
+func (store *MemoryStore) DeleteChannel(name Name) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.channels, name.ToLower())
+	return nil
+}
+
+func (store *MemoryStore) UpdateChannels(saves []*ChannelRecord,
+	deletes []Name) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, record := range saves {
+		store.channels[record.name.ToLower()] = record
+	}
+	for _, name := range deletes {
+		delete(store.channels, name.ToLower())
+	}
+	return nil
+}
+
+func (store *MemoryStore) Accounts() ([]*AccountRecord, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	records := make([]*AccountRecord, 0, len(store.accounts))
+	for _, record := range store.accounts {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (store *MemoryStore) Account(name Name) (*AccountRecord, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	return store.accounts[name.ToLower()], nil
+}
+
+func (store *MemoryStore) SaveAccount(record *AccountRecord) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.accounts[record.name.ToLower()] = record
+	return nil
+}
+
+func (store *MemoryStore) DeleteAccount(name Name) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.accounts, name.ToLower())
+	return nil
+}
+
+func (store *MemoryStore) Bans() ([]*BanRecord, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	records := make([]*BanRecord, 0, len(store.bans))
+	for _, record := range store.bans {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (store *MemoryStore) SaveBan(record *BanRecord) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.bans[record.mask] = record
+	return nil
+}
+
+func (store *MemoryStore) DeleteBan(mask Name) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	delete(store.bans, mask)
+	return nil
+}
+
+func (store *MemoryStore) Import(channels []*ChannelRecord,
+	accounts []*AccountRecord, bans []*BanRecord) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	for _, record := range channels {
+		store.channels[record.name.ToLower()] = record
+	}
+	for _, record := range accounts {
+		store.accounts[record.name.ToLower()] = record
+	}
+	for _, record := range bans {
+		store.bans[record.mask] = record
+	}
+	return nil
+}
+
+func (store *MemoryStore) WhoWas(limit int) ([]*WhoWas, error) {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	results := make([]*WhoWas, 0)
+	for index := len(store.whoWas) - 1; index >= 0; index -= 1 {
+		if len(results) >= limit {
+			break
+		}
+		results = append(results, store.whoWas[index])
+	}
+	return results, nil
+}
+
+func (store *MemoryStore) SaveWhoWas(entries []*WhoWas, keep int) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+
+	store.whoWas = append(store.whoWas, entries...)
+	if len(store.whoWas) > keep {
+		store.whoWas = store.whoWas[len(store.whoWas)-keep:]
+	}
+	return nil
+}
+
+func (store *MemoryStore) Close() error {
+	return nil
+}
@@ -1,6 +1,8 @@
 package irc
 
 import (
+	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -67,34 +69,262 @@ var (
 )
 
 const (
-	Anonymous       ChannelMode = 'a' // flag
 	BanMask         ChannelMode = 'b' // arg
+	ChannelAdmin    ChannelMode = 'a' // arg
 	ChannelCreator  ChannelMode = 'O' // flag
 	ChannelOperator ChannelMode = 'o' // arg
+	ChannelOwner    ChannelMode = 'y' // arg
 	ExceptMask      ChannelMode = 'e' // arg
+	Forward         ChannelMode = 'f' // flag arg
+	HalfOperator    ChannelMode = 'h' // arg
 	InviteMask      ChannelMode = 'I' // arg
 	InviteOnly      ChannelMode = 'i' // flag
+	JoinThrottle    ChannelMode = 'j' // flag arg
 	Key             ChannelMode = 'k' // flag arg
 	Moderated       ChannelMode = 'm' // flag
+	NoColor         ChannelMode = 'c' // flag
+	NoCTCP          ChannelMode = 'C' // flag
+	NoKnock         ChannelMode = 'K' // flag
 	NoOutside       ChannelMode = 'n' // flag
 	OpOnlyTopic     ChannelMode = 't' // flag
 	Persistent      ChannelMode = 'P' // flag
 	Private         ChannelMode = 'p' // flag
-	Quiet           ChannelMode = 'q' // flag
+	QuietMask       ChannelMode = 'q' // arg
+	RegisteredOnly  ChannelMode = 'R' // flag
+	RegisteredSpeak ChannelMode = 'M' // flag
 	ReOp            ChannelMode = 'r' // flag
 	Secret          ChannelMode = 's' // flag, deprecated
-	Theater         ChannelMode = 'T' // flag, nonstandard
+	Theater         ChannelMode = 'T' // member, nonstandard
+	TLSOnly         ChannelMode = 'S' // flag
 	UserLimit       ChannelMode = 'l' // flag arg
 	Voice           ChannelMode = 'v' // arg
 )
 
+// ChannelModeKind says how a channel mode takes parameters. The first four
+// are the CHANMODES types.
+type ChannelModeKind uint
+
+const (
+	ChannelModeList       ChannelModeKind = iota // a list of masks
+	ChannelModeParam                             // always has a parameter
+	ChannelModeParamOnSet                        // has a parameter when set
+	ChannelModeFlag                              // never has a parameter
+	ChannelModePrefix                            // membership modes
+)
+
+// TakesArg is true if a change with `op` consumes a parameter.
+func (kind ChannelModeKind) TakesArg(op ModeOp) bool {
+	switch kind {
+	case ChannelModeList, ChannelModeParam, ChannelModePrefix:
+		return true
+	case ChannelModeParamOnSet:
+		return op == Add
+	}
+	return false
+}
+
+// ChannelModeSpec describes a channel mode that can be changed with MODE.
+type ChannelModeSpec struct {
+	mode ChannelMode
+	kind ChannelModeKind
+
+	// membersOnly modes are only shown to members and operators.
+	membersOnly bool
+
+	// hidesChannel modes hide the channel from LIST, NAMES and WHOIS for
+	// clients who aren't members.
+	hidesChannel bool
+
+	// apply makes a change and is true if the change should be broadcast.
+	// A change that is refused returns why.
+	apply func(*Channel, *Client, *ChannelModeChange) (bool, *ChannelModeError)
+
+	// param is the current parameter of a mode with parameters, or "" if
+	// the mode isn't set.
+	param func(*Channel) string
+}
+
+// ChannelModeError is why a channel mode change was refused. MODE replies
+// with its numeric; the channel subcommands print it.
+type ChannelModeError struct {
+	code NumericCode
+	arg  Name // the mode, nick, mask or channel that was refused
+}
+
+func NewChannelModeError(code NumericCode, arg Name) *ChannelModeError {
+	return &ChannelModeError{
+		code: code,
+		arg:  arg,
+	}
+}
+
+func (err *ChannelModeError) Error() string {
+	switch err.code {
+	case ERR_CHANOPRIVSNEEDED:
+		return "channel operator privileges needed"
+	case ERR_NEEDMOREPARAMS:
+		return "missing or invalid parameter"
+	case ERR_NOSUCHNICK:
+		return fmt.Sprintf("no such nick: %s", err.arg)
+	case ERR_USERNOTINCHANNEL:
+		return fmt.Sprintf("%s isn't on the channel", err.arg)
+	case ERR_BADMASK:
+		return fmt.Sprintf("invalid mask: %s", err.arg)
+	case ERR_NOSUCHCHANNEL:
+		return fmt.Sprintf("invalid channel: %s", err.arg)
+	case ERR_UNKNOWNMODE:
+		return fmt.Sprintf("unknown mode: %s", err.arg)
+	}
+	return fmt.Sprintf("mode change refused (%s)", err.code)
+}
+
 var (
-	SupportedChannelModes = ChannelModes{
-		BanMask, ExceptMask, InviteMask, InviteOnly, Key, NoOutside,
-		OpOnlyTopic, Persistent, Private, Theater, UserLimit,
+	// SupportedChannelModes are the modes in the registry, in order.
+	SupportedChannelModes ChannelModes
+
+	channelModeRegistry = make(map[ChannelMode]*ChannelModeSpec)
+
+	// ChannelMemberModes are the ranked channel membership modes, highest
+	// rank first.
+	ChannelMemberModes = ChannelModes{
+		ChannelOwner, ChannelAdmin, ChannelOperator, HalfOperator, Voice,
+	}
+
+	channelMemberPrefixes = map[ChannelMode]string{
+		ChannelOwner:    "~",
+		ChannelAdmin:    "&",
+		ChannelOperator: "@",
+		HalfOperator:    "%",
+		Voice:           "+",
 	}
 )
 
+// Rank orders membership modes. Modes that are not membership modes have
+// rank 0.
+func (mode ChannelMode) Rank() int {
+	for index, memberMode := range ChannelMemberModes {
+		if mode == memberMode {
+			return len(ChannelMemberModes) - index
+		}
+	}
+	return 0
+}
+
+// Prefix is the NAMES and WHO prefix of a membership mode.
+func (mode ChannelMode) Prefix() string {
+	return channelMemberPrefixes[mode]
+}
+
+func init() {
+	RegisterChannelModes(
+		&ChannelModeSpec{mode: BanMask, kind: ChannelModeList,
+			apply: (*Channel).applyModeMask},
+		&ChannelModeSpec{mode: ExceptMask, kind: ChannelModeList,
+			apply: (*Channel).applyModeMask},
+		&ChannelModeSpec{mode: Forward, kind: ChannelModeParamOnSet,
+			apply: (*Channel).applyModeForward,
+			param: func(channel *Channel) string {
+				return channel.forward.String()
+			}},
+		&ChannelModeSpec{mode: InviteMask, kind: ChannelModeList,
+			apply: (*Channel).applyModeMask},
+		&ChannelModeSpec{mode: InviteOnly, kind: ChannelModeFlag,
+			apply: (*Channel).applyModeFlag},
+		&ChannelModeSpec{mode: JoinThrottle, kind: ChannelModeParamOnSet,
+			apply: (*Channel).applyModeJoinThrottle,
+			param: func(channel *Channel) string {
+				if channel.joinThrottle == nil {
+					return ""
+				}
+				return channel.joinThrottle.String()
+			}},
+		&ChannelModeSpec{mode: Key, kind: ChannelModeParam, membersOnly: true,
+			apply: (*Channel).applyModeKey,
+			param: func(channel *Channel) string {
+				return channel.key.String()
+			}},
+		&ChannelModeSpec{mode: Moderated, kind: ChannelModeFlag,
+			apply: (*Channel).applyModeFlag},
+		&ChannelModeSpec{mode: NoColor, kind: ChannelModeFlag,
+			apply: (*Channel).applyModeFlag},
+		&ChannelModeSpec{mode: NoCTCP, kind: ChannelModeFlag,
+			apply: (*Channel).applyModeFlag},
+		&ChannelModeSpec{mode: NoKnock, kind: ChannelModeFlag,
+			apply: (*Channel).applyModeFlag},
+		&ChannelModeSpec{mode: NoOutside, kind: ChannelModeFlag,
+			apply: (*Channel).applyModeFlag},
+		&ChannelModeSpec{mode: OpOnlyTopic, kind: ChannelModeFlag,
+			apply: (*Channel).applyModeFlag},
+		&ChannelModeSpec{mode: Persistent, kind: ChannelModeFlag,
+			apply: (*Channel).applyModeFlag},
+		&ChannelModeSpec{mode: Private, kind: ChannelModeFlag, hidesChannel: true,
+			apply: (*Channel).applyModeFlag},
+		&ChannelModeSpec{mode: QuietMask, kind: ChannelModeList,
+			apply: (*Channel).applyModeMask},
+		&ChannelModeSpec{mode: RegisteredOnly, kind: ChannelModeFlag,
+			apply: (*Channel).applyModeFlag},
+		&ChannelModeSpec{mode: RegisteredSpeak, kind: ChannelModeFlag,
+			apply: (*Channel).applyModeFlag},
+		&ChannelModeSpec{mode: Secret, kind: ChannelModeFlag, hidesChannel: true,
+			apply: (*Channel).applyModeFlag},
+		&ChannelModeSpec{mode: TLSOnly, kind: ChannelModeFlag,
+			apply: (*Channel).applyModeFlag},
+		&ChannelModeSpec{mode: UserLimit, kind: ChannelModeParamOnSet,
+			apply: (*Channel).applyModeUserLimit,
+			param: func(channel *Channel) string {
+				if channel.userLimit == 0 {
+					return ""
+				}
+				return strconv.FormatUint(channel.userLimit, 10)
+			}},
+	)
+	for _, mode := range ChannelMemberModes {
+		RegisterChannelModes(&ChannelModeSpec{mode: mode, kind: ChannelModePrefix,
+			apply: (*Channel).applyModeMember})
+	}
+}
+
+// RegisterChannelModes adds modes to the registry, which drives parsing,
+// applying, showing and advertising channel modes.
+func RegisterChannelModes(specs ...*ChannelModeSpec) {
+	for _, spec := range specs {
+		if channelModeRegistry[spec.mode] == nil {
+			SupportedChannelModes = append(SupportedChannelModes, spec.mode)
+		}
+		channelModeRegistry[spec.mode] = spec
+	}
+}
+
+// LookupChannelMode returns nil for modes that can't be changed with MODE.
+func LookupChannelMode(mode ChannelMode) *ChannelModeSpec {
+	return channelModeRegistry[mode]
+}
+
+// CHANMODES=<list>,<always arg>,<arg on set>,<flag>
+func ChannelModeTypes() string {
+	types := make([]ChannelModes, ChannelModePrefix)
+	for _, mode := range SupportedChannelModes {
+		kind := LookupChannelMode(mode).kind
+		if kind < ChannelModePrefix {
+			types[kind] = append(types[kind], mode)
+		}
+	}
+	strs := make([]string, len(types))
+	for index, modes := range types {
+		strs[index] = modes.String()
+	}
+	return strings.Join(strs, ",")
+}
+
+// PREFIX=(yaohv)~&@%+
+func ChannelMemberPrefixes() string {
+	prefixes := ""
+	for _, mode := range ChannelMemberModes {
+		prefixes += mode.Prefix()
+	}
+	return "(" + ChannelMemberModes.String() + ")" + prefixes
+}
+
 //
 // commands
 //
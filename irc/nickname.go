@@ -27,11 +27,16 @@ func (m *NickCommand) HandleRegServer(s *Server) {
 		return
 	}
 
-	if !m.nickname.IsNickname() {
+	if !m.nickname.IsNickname() || !s.scripts.Allows(m.nickname) {
 		client.ErrErroneusNickname(m.nickname)
 		return
 	}
 
+	if s.IsNickConfusable(client, m.nickname) {
+		client.ErrNickNameInUse(m.nickname)
+		return
+	}
+
 	client.SetNickname(m.nickname)
 	s.tryRegister(client)
 }
@@ -44,7 +49,7 @@ func (msg *NickCommand) HandleServer(server *Server) {
 		return
 	}
 
-	if !msg.nickname.IsNickname() {
+	if !msg.nickname.IsNickname() || !server.scripts.Allows(msg.nickname) {
 		client.ErrErroneusNickname(msg.nickname)
 		return
 	}
@@ -59,6 +64,18 @@ func (msg *NickCommand) HandleServer(server *Server) {
 		return
 	}
 
+	if server.IsNickConfusable(client, msg.nickname) {
+		client.ErrNickNameInUse(msg.nickname)
+		return
+	}
+
+	for channel := range client.channels {
+		if channel.IsQuieted(client) {
+			client.ErrBanNickChange(msg.nickname, channel)
+			return
+		}
+	}
+
 	client.ChangeNickname(msg.nickname)
 }
 
@@ -76,7 +93,7 @@ func (msg *OperNickCommand) HandleServer(server *Server) {
 		return
 	}
 
-	if !msg.nick.IsNickname() {
+	if !msg.nick.IsNickname() || !server.scripts.Allows(msg.nick) {
 		client.ErrErroneusNickname(msg.nick)
 		return
 	}
@@ -91,7 +108,8 @@ func (msg *OperNickCommand) HandleServer(server *Server) {
 		return
 	}
 
-	if server.clients.Get(msg.nick) != nil {
+	if (server.clients.Get(msg.nick) != nil) ||
+		server.IsNickConfusable(target, msg.nick) {
 		client.ErrNickNameInUse(msg.nick)
 		return
 	}
@@ -10,12 +10,18 @@ var (
 	EmptyPasswordError = errors.New("empty password")
 )
 
-func GenerateEncodedPassword(passwd string) (encoded string, err error) {
+// GenerateHash bcrypts a password for an account.
+func GenerateHash(passwd string) (hash []byte, err error) {
 	if passwd == "" {
 		err = EmptyPasswordError
 		return
 	}
-	bcrypted, err := bcrypt.GenerateFromPassword([]byte(passwd), bcrypt.MinCost)
+	hash, err = bcrypt.GenerateFromPassword([]byte(passwd), bcrypt.MinCost)
+	return
+}
+
+func GenerateEncodedPassword(passwd string) (encoded string, err error) {
+	bcrypted, err := GenerateHash(passwd)
 	if err != nil {
 		return
 	}
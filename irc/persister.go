@@ -0,0 +1,148 @@
+package irc
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	PERSIST_QUEUE_LEN  = 1024        // changes buffered before Persist blocks
+	PERSIST_INTERVAL   = time.Second // how long changes are collected
+	PERSIST_BATCH_SIZE = 256         // changes written before flushing early
+)
+
+// PersistChange is a channel to save, or to delete if `record` is nil, or
+// a WHOWAS entry to add.
+type PersistChange struct {
+	channel Name
+	record  *ChannelRecord
+	whoWas  *WhoWas
+}
+
+type persistBatch struct {
+	channels map[Name]*PersistChange
+	whoWas   []*WhoWas
+}
+
+func (batch *persistBatch) Add(change *PersistChange) {
+	if change.whoWas != nil {
+		batch.whoWas = append(batch.whoWas, change.whoWas)
+	} else {
+		batch.channels[change.channel.ToLower()] = change
+	}
+}
+
+func (batch *persistBatch) Len() int {
+	return len(batch.channels) + len(batch.whoWas)
+}
+
+// Persister writes changes to the store on its own goroutine, so a slow
+// disk doesn't hold up the server. Changes to the same channel made within
+// PERSIST_INTERVAL of each other are written once.
+type Persister struct {
+	changes    chan *PersistChange
+	done       chan bool
+	store      Store
+	whoWasKeep int
+}
+
+// NewPersister keeps the newest `whoWasKeep` WHOWAS entries in the store.
+func NewPersister(store Store, whoWasKeep int) *Persister {
+	persister := &Persister{
+		changes:    make(chan *PersistChange, PERSIST_QUEUE_LEN),
+		done:       make(chan bool),
+		store:      store,
+		whoWasKeep: whoWasKeep,
+	}
+	go persister.run()
+	return persister
+}
+
+func (persister *Persister) Save(record *ChannelRecord) {
+	persister.changes <- &PersistChange{
+		channel: record.name,
+		record:  record,
+	}
+}
+
+func (persister *Persister) Delete(name Name) {
+	persister.changes <- &PersistChange{
+		channel: name,
+	}
+}
+
+func (persister *Persister) AddWhoWas(whoWas *WhoWas) {
+	persister.changes <- &PersistChange{
+		whoWas: whoWas,
+	}
+}
+
+// Close writes everything that is still queued and waits for it to finish.
+func (persister *Persister) Close() {
+	close(persister.changes)
+	<-persister.done
+}
+
+//
+// persister goroutine
+//
+
+func (persister *Persister) run() {
+	defer close(persister.done)
+
+	for change := range persister.changes {
+		batch := &persistBatch{
+			channels: make(map[Name]*PersistChange),
+		}
+		batch.Add(change)
+		open := persister.collect(batch)
+		persister.flush(batch)
+		if !open {
+			return
+		}
+	}
+}
+
+// collect adds changes to `batch` until PERSIST_INTERVAL has passed, the
+// batch is full or the queue is closed. It is false if the queue is closed.
+func (persister *Persister) collect(batch *persistBatch) bool {
+	timeout := time.After(PERSIST_INTERVAL)
+	for batch.Len() < PERSIST_BATCH_SIZE {
+		select {
+		case change, ok := <-persister.changes:
+			if !ok {
+				return false
+			}
+			batch.Add(change)
+
+		case <-timeout:
+			return true
+		}
+	}
+	return true
+}
+
+func (persister *Persister) flush(batch *persistBatch) {
+	if len(batch.channels) > 0 {
+		saves := make([]*ChannelRecord, 0, len(batch.channels))
+		deletes := make([]Name, 0)
+		for _, change := range batch.channels {
+			if change.record == nil {
+				deletes = append(deletes, change.channel)
+			} else {
+				saves = append(saves, change.record)
+			}
+		}
+
+		if err := persister.store.UpdateChannels(saves, deletes); err != nil {
+			log.Println("Persister.flush:", err)
+		}
+	}
+
+	if len(batch.whoWas) > 0 {
+		err := persister.store.SaveWhoWas(batch.whoWas, persister.whoWasKeep)
+		if err != nil {
+			log.Println("Persister.flush:", err)
+		}
+	}
+}
@@ -0,0 +1,187 @@
+package irc
+
+import (
+	"bytes"
+	"code.google.com/p/go.text/unicode/norm"
+	"strings"
+	"unicode"
+)
+
+// The rfc7613 casemapping is the PRECIS UsernameCaseMapped profile
+// (RFC 7613 section 3.2). Folding applies its mapping rules: fullwidth and
+// halfwidth characters become their usual forms, then the name is
+// lowercased and normalized to NFC. Nicks must also pass its validity
+// rules: the IdentifierClass and, when they contain right-to-left
+// characters, the Bidi Rule of RFC 5893.
+//
+// Characters that PRECIS only allows in certain contexts, like ZERO WIDTH
+// JOINER and MIDDLE DOT, are refused everywhere.
+
+func foldPRECIS(str string) string {
+	return norm.NFC.String(strings.ToLower(mapWidth(str)))
+}
+
+// mapWidth replaces characters that have <wide> or <narrow> decompositions:
+// the ideographic space and the Halfwidth and Fullwidth Forms block.
+func mapWidth(str string) string {
+	var buffer bytes.Buffer
+	for _, char := range str {
+		if (char == 0x3000) || ((0xFF01 <= char) && (char <= 0xFFEE)) {
+			buffer.WriteString(norm.NFKC.String(string(char)))
+		} else {
+			buffer.WriteRune(char)
+		}
+	}
+	return buffer.String()
+}
+
+// allowsPRECIS is true if `str` is a valid UsernameCaseMapped string.
+func allowsPRECIS(str string) bool {
+	if str == "" {
+		return false
+	}
+	for _, char := range str {
+		if !isIdentifierChar(char) {
+			return false
+		}
+	}
+	return passesBidiRule(str)
+}
+
+var (
+	// LetterDigits from RFC 5892, the letters and digits of every script
+	precisLetterDigits = []*unicode.RangeTable{unicode.Ll, unicode.Lu,
+		unicode.Lo, unicode.Lm, unicode.Mn, unicode.Mc, unicode.Nd}
+
+	// Exceptions from RFC 5892 that are DISALLOWED
+	precisDisallowed = map[rune]bool{0x0640: true, 0x07FA: true, 0x302E: true,
+		0x302F: true, 0x3031: true, 0x3032: true, 0x3033: true, 0x3034: true,
+		0x3035: true, 0x303B: true}
+
+	// conjoining Hangul jamo, which PRECIS calls OldHangulJamo
+	hangulJamo = &unicode.RangeTable{R16: []unicode.Range16{
+		{0x1100, 0x11FF, 1}, {0xA960, 0xA97F, 1}, {0xD7B0, 0xD7FF, 1}}}
+)
+
+// isIdentifierChar is true for the characters the PRECIS IdentifierClass
+// allows: printable ASCII, and letters and digits without compatibility
+// forms.
+func isIdentifierChar(char rune) bool {
+	if (0x21 <= char) && (char <= 0x7E) {
+		return true
+	}
+	if precisDisallowed[char] || unicode.Is(hangulJamo, char) {
+		return false
+	}
+	if !unicode.IsOneOf(precisLetterDigits, char) {
+		return false
+	}
+	return norm.NFKC.String(string(char)) == string(char)
+}
+
+// bidi classes, as far as the Bidi Rule needs them. R includes AL.
+type bidiClass uint
+
+const (
+	bidiL bidiClass = iota
+	bidiR
+	bidiEN
+	bidiAN
+	bidiES
+	bidiCS
+	bidiET
+	bidiON
+	bidiNSM
+)
+
+var (
+	// scripts written right to left, whose letters are class R or AL
+	rtlScripts = []*unicode.RangeTable{unicode.Arabic, unicode.Hebrew,
+		unicode.Syriac, unicode.Thaana, unicode.Nko, unicode.Samaritan,
+		unicode.Mandaic, unicode.Avestan, unicode.Cypriot,
+		unicode.Imperial_Aramaic, unicode.Inscriptional_Pahlavi,
+		unicode.Inscriptional_Parthian, unicode.Kharoshthi, unicode.Lydian,
+		unicode.Old_South_Arabian, unicode.Old_Turkic, unicode.Phoenician}
+)
+
+// classifyBidi gives the bidi class of a character that isIdentifierChar
+// allows.
+func classifyBidi(char rune) bidiClass {
+	if char < 0x80 {
+		switch {
+		case (('a' <= char) && (char <= 'z')) || (('A' <= char) && (char <= 'Z')):
+			return bidiL
+		case ('0' <= char) && (char <= '9'):
+			return bidiEN
+		case strings.ContainsRune("+-", char):
+			return bidiES
+		case strings.ContainsRune(",./:", char):
+			return bidiCS
+		case strings.ContainsRune("#$%", char):
+			return bidiET
+		}
+		return bidiON
+	}
+	switch {
+	case unicode.Is(unicode.Mn, char):
+		return bidiNSM
+	case (0x0660 <= char) && (char <= 0x0669):
+		return bidiAN
+	case (0x06F0 <= char) && (char <= 0x06F9):
+		return bidiEN
+	case unicode.IsOneOf(rtlScripts, char):
+		return bidiR
+	}
+	return bidiL
+}
+
+// passesBidiRule checks the six conditions of RFC 5893 section 2 for
+// strings with right-to-left characters. Other strings always pass.
+func passesBidiRule(str string) bool {
+	classes := make([]bidiClass, 0, len(str))
+	isRTL := false
+	for _, char := range str {
+		class := classifyBidi(char)
+		if (class == bidiR) || (class == bidiAN) {
+			isRTL = true
+		}
+		classes = append(classes, class)
+	}
+	if !isRTL {
+		return true
+	}
+
+	// 1. the first character is L, R or AL, and it decides the direction.
+	// 5. an LTR label has no R, AL or AN, so this one must be RTL.
+	if classes[0] != bidiR {
+		return false
+	}
+
+	// 2. an RTL label has no L
+	hasEN, hasAN := false, false
+	for _, class := range classes {
+		switch class {
+		case bidiL:
+			return false
+		case bidiEN:
+			hasEN = true
+		case bidiAN:
+			hasAN = true
+		}
+	}
+	// 4. an RTL label doesn't mix EN and AN
+	if hasEN && hasAN {
+		return false
+	}
+
+	// 3. an RTL label ends with R, AL, EN or AN, then any NSMs
+	last := len(classes) - 1
+	for (last > 0) && (classes[last] == bidiNSM) {
+		last -= 1
+	}
+	switch classes[last] {
+	case bidiR, bidiEN, bidiAN:
+		return true
+	}
+	return false
+}
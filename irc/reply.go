@@ -51,9 +51,12 @@ func NewNumericReply(target *Client, code NumericCode,
 	return header + message
 }
 
+// NumericReply cuts replies that are too long for one line. Replies that
+// may be long should use MultilineReply or TextReply instead.
 func (target *Client) NumericReply(code NumericCode,
 	format string, args ...interface{}) {
-	target.Reply(NewNumericReply(target, code, format, args...))
+	reply := NewNumericReply(target, code, format, args...)
+	target.Reply(truncateUTF8(reply, MAX_REPLY_LEN))
 }
 
 //
@@ -68,29 +71,41 @@ func joinedLen(names []string) int {
 	return l
 }
 
+// MultilineReply sends `names` in as few replies as fit. The last verb in
+// `format` is the space-separated names; `args` fill in the others.
 func (target *Client) MultilineReply(names []string, code NumericCode, format string,
 	args ...interface{}) {
-	baseLen := len(NewNumericReply(target, code, format))
-	tooLong := func(names []string) bool {
-		return (baseLen + joinedLen(names)) > MAX_REPLY_LEN
-	}
-	argsAndNames := func(names []string) []interface{} {
-		return append(args, strings.Join(names, " "))
-	}
-	from, to := 0, 1
-	for to < len(names) {
-		if (from < (to - 1)) && tooLong(names[from:to]) {
-			target.NumericReply(code, format, argsAndNames(names[from:to-1])...)
-			from = to - 1
-		} else {
-			to += 1
+	baseLen := len(NewNumericReply(target, code, format, argsAnd(args, "")...))
+	from := 0
+	for to := 1; to <= len(names); to += 1 {
+		if (to == len(names)) || (baseLen+joinedLen(names[from:to+1]) > MAX_REPLY_LEN) {
+			target.NumericReply(code, format,
+				argsAnd(args, strings.Join(names[from:to], " "))...)
+			from = to
 		}
 	}
-	if from < len(names) {
-		target.NumericReply(code, format, argsAndNames(names[from:])...)
+}
+
+// TextReply sends `text` in as many replies as it takes, cutting it
+// between characters. The last verb in `format` is the text; `args` fill
+// in the others.
+func (target *Client) TextReply(text string, code NumericCode, format string,
+	args ...interface{}) {
+	room := MAX_REPLY_LEN - len(NewNumericReply(target, code, format, argsAnd(args, "")...))
+	if room < 1 {
+		room = 1
+	}
+	for _, piece := range splitUTF8(text, room) {
+		target.NumericReply(code, format, argsAnd(args, piece)...)
 	}
 }
 
+func argsAnd(args []interface{}, last string) []interface{} {
+	all := make([]interface{}, len(args), len(args)+1)
+	copy(all, args)
+	return append(all, last)
+}
+
 //
 // messaging replies
 //
@@ -99,14 +114,52 @@ func RplPrivMsg(source Identifiable, target Identifiable, message Text) string {
 	return NewStringReply(source, PRIVMSG, "%s :%s", target.Nick(), message)
 }
 
+// RplPrivMsgs relays a PRIVMSG, split over several lines if it's too long
+// for one.
+func RplPrivMsgs(source Identifiable, target Identifiable, message Text) []string {
+	return splitMessage(source, PRIVMSG, target, message)
+}
+
+// RplCTCPAction cuts actions that are too long for one line.
 func RplCTCPAction(source Identifiable, target Identifiable, action CTCPText) string {
-	return RplPrivMsg(source, target, NewText(fmt.Sprintf("\x01ACTION %s\x01", action)))
+	message := NewText(fmt.Sprintf("\x01ACTION %s\x01", action))
+	return splitMessage(source, PRIVMSG, target, message)[0]
 }
 
 func RplNotice(source Identifiable, target Identifiable, message Text) string {
 	return NewStringReply(source, NOTICE, "%s :%s", target.Nick(), message)
 }
 
+// RplNotices relays a NOTICE, split over several lines if it's too long
+// for one.
+func RplNotices(source Identifiable, target Identifiable, message Text) []string {
+	return splitMessage(source, NOTICE, target, message)
+}
+
+// splitMessage cuts the text of a PRIVMSG or NOTICE between characters so
+// that every line fits in MAX_REPLY_LEN. CTCP messages are cut short
+// instead, keeping their closing \x01.
+func splitMessage(source Identifiable, code StringCode, target Identifiable,
+	message Text) []string {
+	header := NewStringReply(source, code, "%s :", target.Nick())
+	room := MAX_REPLY_LEN - len(header)
+	if room < 2 {
+		room = 2
+	}
+
+	text := message.String()
+	if message.IsCTCP(false) && (len(text) > room) {
+		text = truncateUTF8(strings.TrimSuffix(text, "\x01"), room-1) + "\x01"
+		return []string{header + text}
+	}
+
+	replies := make([]string, 0, 1)
+	for _, piece := range splitUTF8(text, room) {
+		replies = append(replies, header+piece)
+	}
+	return replies
+}
+
 func RplNick(source Identifiable, newNick Name) string {
 	return NewStringReply(source, NICK, newNick.String())
 }
@@ -138,9 +191,9 @@ func RplCurrentMode(client *Client, target *Client) string {
 	return RplNotice(client.server, client, response)
 }
 
-func RplChannelMode(client *Client, channel *Channel,
+func RplChannelMode(source Identifiable, channel *Channel,
 	changes ChannelModeChanges) string {
-	return NewStringReply(client, MODE, "%s %s", channel, changes)
+	return NewStringReply(source, MODE, "%s %s", channel, changes)
 }
 
 func RplTopicMsg(source Identifiable, channel *Channel) string {
@@ -204,6 +257,11 @@ func (target *Client) RplMyInfo() {
 		target.server.name, SEM_VER, SupportedUserModes, SupportedChannelModes)
 }
 
+func (target *Client) RplISupport(tokens []string) {
+	target.MultilineReply(tokens, RPL_ISUPPORT,
+		"%s :are supported by this server")
+}
+
 func (target *Client) RplUModeIs(client *Client) {
 	target.NumericReply(RPL_UMODEIS, client.ModeString())
 }
@@ -214,8 +272,20 @@ func (target *Client) RplNoTopic(channel *Channel) {
 }
 
 func (target *Client) RplTopic(channel *Channel) {
-	target.NumericReply(RPL_TOPIC,
-		"%s :%s", channel.name, channel.topic)
+	target.TextReply(channel.topic.String(), RPL_TOPIC,
+		"%s :%s", channel.name)
+}
+
+// <channel> <nick!user@host> <setat>
+func (target *Client) RplTopicWhoTime(channel *Channel) {
+	target.NumericReply(RPL_TOPICWHOTIME,
+		"%s %s %d", channel.name, channel.topicSetBy, channel.topicTime.Unix())
+}
+
+// <channel> <creationtime>
+func (target *Client) RplCreationTime(channel *Channel) {
+	target.NumericReply(RPL_CREATIONTIME,
+		"%s %d", channel.name, channel.ctime.Unix())
 }
 
 // <nick> <channel>
@@ -231,6 +301,12 @@ func (target *Client) RplEndOfNames(channel *Channel) {
 }
 
 // :You are now an IRC operator
+func (target *Client) RplLoggedIn() {
+	target.NumericReply(RPL_LOGGEDIN,
+		"%s %s :You are now logged in as %s",
+		target.UserHost(), target.account, target.account)
+}
+
 func (target *Client) RplYoureOper() {
 	target.NumericReply(RPL_YOUREOPER,
 		":You are now an IRC operator")
@@ -238,18 +314,35 @@ func (target *Client) RplYoureOper() {
 
 func (target *Client) RplWhois(client *Client) {
 	target.RplWhoisUser(client)
+	target.RplWhoisServer(client)
+	target.RplWhoisChannels(client)
 	if client.flags[Operator] {
 		target.RplWhoisOperator(client)
 	}
+	if client.flags[Away] {
+		target.RplAway(client)
+	}
+	if client.IsSecure() {
+		target.RplWhoisSecure(client)
+	}
+	if client.account != "" {
+		target.RplWhoisAccount(client)
+	}
+	if target.flags[Operator] || (target == client) {
+		target.RplWhoisActually(client)
+	}
 	target.RplWhoisIdle(client)
-	target.RplWhoisChannels(client)
-	target.RplEndOfWhois()
+	target.RplEndOfWhois(client.Nick())
 }
 
 func (target *Client) RplWhoisUser(client *Client) {
-	target.NumericReply(RPL_WHOISUSER,
-		"%s %s %s * :%s", client.Nick(), client.username, client.hostname,
-		client.realname)
+	target.TextReply(client.realname.String(), RPL_WHOISUSER,
+		"%s %s %s * :%s", client.Nick(), client.username, client.hostname)
+}
+
+func (target *Client) RplWhoisServer(client *Client) {
+	target.NumericReply(RPL_WHOISSERVER,
+		"%s %s :%s", client.Nick(), client.server.name, SEM_VER)
 }
 
 func (target *Client) RplWhoisOperator(client *Client) {
@@ -257,15 +350,32 @@ func (target *Client) RplWhoisOperator(client *Client) {
 		"%s :is an IRC operator", client.Nick())
 }
 
+func (target *Client) RplWhoisSecure(client *Client) {
+	target.NumericReply(RPL_WHOISSECURE,
+		"%s :is using a secure connection", client.Nick())
+}
+
+func (target *Client) RplWhoisAccount(client *Client) {
+	target.NumericReply(RPL_WHOISACCOUNT,
+		"%s %s :is logged in as", client.Nick(), client.account)
+}
+
+// <nick> <user>@<host> <ip> :actually using host
+func (target *Client) RplWhoisActually(client *Client) {
+	target.NumericReply(RPL_WHOISACTUALLY,
+		"%s %s@%s %s :actually using host", client.Nick(), client.username,
+		client.hostname, client.ip)
+}
+
 func (target *Client) RplWhoisIdle(client *Client) {
 	target.NumericReply(RPL_WHOISIDLE,
 		"%s %d %d :seconds idle, signon time",
 		client.Nick(), client.IdleSeconds(), client.SignonTime())
 }
 
-func (target *Client) RplEndOfWhois() {
+func (target *Client) RplEndOfWhois(nick Name) {
 	target.NumericReply(RPL_ENDOFWHOIS,
-		":End of WHOIS list")
+		"%s :End of WHOIS list", nick)
 }
 
 func (target *Client) RplChannelModeIs(channel *Channel) {
@@ -273,10 +383,8 @@ func (target *Client) RplChannelModeIs(channel *Channel) {
 		"%s %s", channel, channel.ModeString(target))
 }
 
-// <channel> <user> <host> <server> <nick> ( "H" / "G" ) ["*"] [ ( "@" / "+" ) ]
-// :<hopcount> <real name>
-func (target *Client) RplWhoReply(channel *Channel, client *Client) {
-	channelName := "*"
+// ( "H" / "G" ) ["*"] [ ( "@" / "+" ) ]
+func (target *Client) whoFlags(channel *Channel, client *Client) string {
 	flags := ""
 
 	if client.flags[Away] {
@@ -288,26 +396,85 @@ func (target *Client) RplWhoReply(channel *Channel, client *Client) {
 		flags += "*"
 	}
 
+	if channel != nil {
+		flags += channel.members[client].Prefixes(target.capabilities[MultiPrefix])
+	}
+	return flags
+}
+
+// <channel> <user> <host> <server> <nick> ( "H" / "G" ) ["*"] [ ( "@" / "+" ) ]
+// :<hopcount> <real name>
+func (target *Client) RplWhoReply(channel *Channel, client *Client) {
+	channelName := "*"
 	if channel != nil {
 		channelName = channel.name.String()
-		if target.capabilities[MultiPrefix] {
-			if channel.members[client][ChannelOperator] {
-				flags += "@"
-			}
-			if channel.members[client][Voice] {
-				flags += "+"
-			}
-		} else {
-			if channel.members[client][ChannelOperator] {
-				flags += "@"
-			} else if channel.members[client][Voice] {
-				flags += "+"
-			}
-		}
 	}
 	target.NumericReply(RPL_WHOREPLY,
 		"%s %s %s %s %s %s :%d %s", channelName, client.username, client.hostname,
-		client.server.name, client.Nick(), flags, client.hops, client.realname)
+		client.server.name, client.Nick(), target.whoFlags(channel, client),
+		client.hops, client.realname)
+}
+
+// WHOX replies contain the requested fields in the fixed order
+// `tcuihsnfdlaor`. The real name is always last and may contain spaces.
+func (target *Client) RplWhoxReply(channel *Channel, client *Client,
+	fields WhoxFields, token string) {
+	params := make([]string, 0, len(fields))
+	if fields['t'] {
+		if token == "" {
+			token = "0"
+		}
+		params = append(params, token)
+	}
+	if fields['c'] {
+		if channel == nil {
+			params = append(params, "*")
+		} else {
+			params = append(params, channel.name.String())
+		}
+	}
+	if fields['u'] {
+		params = append(params, client.username.String())
+	}
+	if fields['i'] {
+		if target.flags[Operator] || (target == client) {
+			params = append(params, client.ip.String())
+		} else {
+			params = append(params, "255.255.255.255")
+		}
+	}
+	if fields['h'] {
+		params = append(params, client.hostname.String())
+	}
+	if fields['s'] {
+		params = append(params, client.server.name.String())
+	}
+	if fields['n'] {
+		params = append(params, client.Nick().String())
+	}
+	if fields['f'] {
+		params = append(params, target.whoFlags(channel, client))
+	}
+	if fields['d'] {
+		params = append(params, fmt.Sprintf("%d", client.hops))
+	}
+	if fields['l'] {
+		params = append(params, fmt.Sprintf("%d", client.IdleSeconds()))
+	}
+	if fields['a'] {
+		account := "0"
+		if client.account != "" {
+			account = client.account.String()
+		}
+		params = append(params, account)
+	}
+	if fields['o'] {
+		params = append(params, "n/a")
+	}
+	if fields['r'] {
+		params = append(params, ":"+client.realname.String())
+	}
+	target.NumericReply(RPL_WHOSPCRPL, "%s", strings.Join(params, " "))
 }
 
 // <name> :End of WHO list
@@ -316,7 +483,7 @@ func (target *Client) RplEndOfWho(name Name) {
 		"%s :End of WHO list", name)
 }
 
-func (target *Client) RplMaskList(mode ChannelMode, channel *Channel, mask Name) {
+func (target *Client) RplMaskList(mode ChannelMode, channel *Channel, mask *UserMask) {
 	switch mode {
 	case BanMask:
 		target.RplBanList(channel, mask)
@@ -326,7 +493,19 @@ func (target *Client) RplMaskList(mode ChannelMode, channel *Channel, mask Name)
 
 	case InviteMask:
 		target.RplInviteList(channel, mask)
+
+	case QuietMask:
+		target.RplQuietList(channel, mask)
+	}
+}
+
+// Masks loaded from databases that predate setters are credited to the
+// server.
+func (target *Client) maskSetter(mask *UserMask) Name {
+	if mask.setBy == "" {
+		return target.server.name
 	}
+	return mask.setBy
 }
 
 func (target *Client) RplEndOfMaskList(mode ChannelMode, channel *Channel) {
@@ -339,12 +518,17 @@ func (target *Client) RplEndOfMaskList(mode ChannelMode, channel *Channel) {
 
 	case InviteMask:
 		target.RplEndOfInviteList(channel)
+
+	case QuietMask:
+		target.RplEndOfQuietList(channel)
 	}
 }
 
-func (target *Client) RplBanList(channel *Channel, mask Name) {
+// <channel> <mask> <setter> <time>
+func (target *Client) RplBanList(channel *Channel, mask *UserMask) {
 	target.NumericReply(RPL_BANLIST,
-		"%s %s", channel, mask)
+		"%s %s %s %d", channel, mask.mask, target.maskSetter(mask),
+		unixTime(mask.setTime))
 }
 
 func (target *Client) RplEndOfBanList(channel *Channel) {
@@ -352,9 +536,11 @@ func (target *Client) RplEndOfBanList(channel *Channel) {
 		"%s :End of channel ban list", channel)
 }
 
-func (target *Client) RplExceptList(channel *Channel, mask Name) {
+// <channel> <mask> <setter> <time>
+func (target *Client) RplExceptList(channel *Channel, mask *UserMask) {
 	target.NumericReply(RPL_EXCEPTLIST,
-		"%s %s", channel, mask)
+		"%s %s %s %d", channel, mask.mask, target.maskSetter(mask),
+		unixTime(mask.setTime))
 }
 
 func (target *Client) RplEndOfExceptList(channel *Channel) {
@@ -362,9 +548,11 @@ func (target *Client) RplEndOfExceptList(channel *Channel) {
 		"%s :End of channel exception list", channel)
 }
 
-func (target *Client) RplInviteList(channel *Channel, mask Name) {
+// <channel> <mask> <setter> <time>
+func (target *Client) RplInviteList(channel *Channel, mask *UserMask) {
 	target.NumericReply(RPL_INVITELIST,
-		"%s %s", channel, mask)
+		"%s %s %s %d", channel, mask.mask, target.maskSetter(mask),
+		unixTime(mask.setTime))
 }
 
 func (target *Client) RplEndOfInviteList(channel *Channel) {
@@ -372,6 +560,18 @@ func (target *Client) RplEndOfInviteList(channel *Channel) {
 		"%s :End of channel invite list", channel)
 }
 
+// <channel> <mode> <mask> <setter> <time>
+func (target *Client) RplQuietList(channel *Channel, mask *UserMask) {
+	target.NumericReply(RPL_QUIETLIST,
+		"%s %s %s %s %d", channel, QuietMask, mask.mask, target.maskSetter(mask),
+		unixTime(mask.setTime))
+}
+
+func (target *Client) RplEndOfQuietList(channel *Channel) {
+	target.NumericReply(RPL_ENDOFQUIETLIST,
+		"%s %s :End of channel quiet list", channel, QuietMask)
+}
+
 func (target *Client) RplNowAway() {
 	target.NumericReply(RPL_NOWAWAY,
 		":You have been marked as being away")
@@ -383,13 +583,24 @@ func (target *Client) RplUnAway() {
 }
 
 func (target *Client) RplAway(client *Client) {
-	target.NumericReply(RPL_AWAY,
-		"%s :%s", client.Nick(), client.awayMessage)
+	target.TextReply(client.awayMessage.String(), RPL_AWAY,
+		"%s :%s", client.Nick())
 }
 
 func (target *Client) RplIsOn(nicks []string) {
-	target.NumericReply(RPL_ISON,
-		":%s", strings.Join(nicks, " "))
+	if len(nicks) == 0 {
+		target.NumericReply(RPL_ISON, ":")
+		return
+	}
+	target.MultilineReply(nicks, RPL_ISON, ":%s")
+}
+
+func (target *Client) RplUserHost(replies []string) {
+	if len(replies) == 0 {
+		target.NumericReply(RPL_USERHOST, ":")
+		return
+	}
+	target.MultilineReply(replies, RPL_USERHOST, ":%s")
 }
 
 func (target *Client) RplMOTDStart() {
@@ -408,8 +619,8 @@ func (target *Client) RplMOTDEnd() {
 }
 
 func (target *Client) RplList(channel *Channel) {
-	target.NumericReply(RPL_LIST,
-		"%s %d :%s", channel, len(channel.members), channel.topic)
+	target.TextReply(channel.topic.String(), RPL_LIST,
+		"%s %d :%s", channel, len(channel.members))
 }
 
 func (target *Client) RplListEnd(server *Server) {
@@ -419,11 +630,11 @@ func (target *Client) RplListEnd(server *Server) {
 
 func (target *Client) RplNamReply(channel *Channel) {
 	target.MultilineReply(channel.Nicks(target), RPL_NAMREPLY,
-		"= %s :%s", channel)
+		"%s %s :%s", channel.NamesType(), channel)
 }
 
 func (target *Client) RplWhoisChannels(client *Client) {
-	target.MultilineReply(client.WhoisChannelsNames(), RPL_WHOISCHANNELS,
+	target.MultilineReply(client.WhoisChannelsNames(target), RPL_WHOISCHANNELS,
 		"%s :%s", client.Nick())
 }
 
@@ -448,11 +659,114 @@ func (target *Client) RplWhoWasUser(whoWas *WhoWas) {
 		whoWas.nickname, whoWas.username, whoWas.hostname, whoWas.realname)
 }
 
+// <nick> <server> :<sign-off time>
+func (target *Client) RplWhoWasServer(whoWas *WhoWas) {
+	target.NumericReply(RPL_WHOISSERVER,
+		"%s %s :%s", whoWas.nickname, whoWas.server,
+		whoWas.signOff.Format(time.RFC1123))
+}
+
+func (target *Client) RplWhoWasActually(whoWas *WhoWas) {
+	target.NumericReply(RPL_WHOISACTUALLY,
+		"%s %s@%s %s :actually using host", whoWas.nickname, whoWas.username,
+		whoWas.hostname, whoWas.ip)
+}
+
 func (target *Client) RplEndOfWhoWas(nickname Name) {
 	target.NumericReply(RPL_ENDOFWHOWAS,
 		"%s :End of WHOWAS", nickname)
 }
 
+func (target *Client) RplLUserClient(users int, invisible int) {
+	target.NumericReply(RPL_LUSERCLIENT,
+		":There are %d users and %d invisible on 1 servers", users, invisible)
+}
+
+func (target *Client) RplLUserOp(operators int) {
+	target.NumericReply(RPL_LUSEROP,
+		"%d :operator(s) online", operators)
+}
+
+func (target *Client) RplLUserUnknown(unknown int) {
+	target.NumericReply(RPL_LUSERUNKNOWN,
+		"%d :unknown connection(s)", unknown)
+}
+
+func (target *Client) RplLUserChannels(channels int) {
+	target.NumericReply(RPL_LUSERCHANNELS,
+		"%d :channels formed", channels)
+}
+
+func (target *Client) RplLUserMe(clients int) {
+	target.NumericReply(RPL_LUSERME,
+		":I have %d clients and 0 servers", clients)
+}
+
+func (target *Client) RplAdminMe() {
+	target.NumericReply(RPL_ADMINME,
+		"%s :Administrative info", target.server.name)
+}
+
+func (target *Client) RplAdminLoc1(location string) {
+	target.NumericReply(RPL_ADMINLOC1, ":%s", location)
+}
+
+func (target *Client) RplAdminLoc2(location string) {
+	target.NumericReply(RPL_ADMINLOC2, ":%s", location)
+}
+
+func (target *Client) RplAdminEmail(email string) {
+	target.NumericReply(RPL_ADMINEMAIL, ":%s", email)
+}
+
+func (target *Client) RplInfo(line string) {
+	target.NumericReply(RPL_INFO, ":%s", line)
+}
+
+func (target *Client) RplEndOfInfo() {
+	target.NumericReply(RPL_ENDOFINFO, ":End of INFO list")
+}
+
+// K <mask> * * :<reason>
+func (target *Client) RplStatsKLine(mask Name, reason Text) {
+	target.NumericReply(RPL_STATSKLINE,
+		"K %s * * :%s", mask, reason)
+}
+
+// <linkname> <sendq> <sent messages> <sent Kbytes> <received messages>
+// <received Kbytes> <time open>
+func (target *Client) RplStatsLinkInfo(client *Client) {
+	sentMsgs, sentBytes := client.socket.Sent()
+	recvMsgs, recvBytes := client.socket.Received()
+	target.NumericReply(RPL_STATSLINKINFO,
+		"%s[%s] %d %d %d %d %d %d", client.Nick(), client.socket,
+		client.socket.SendQ(), sentMsgs, sentBytes/1024, recvMsgs,
+		recvBytes/1024, uint64(time.Since(client.socket.ctime).Seconds()))
+}
+
+func (target *Client) RplStatsCommands(code StringCode, count uint64) {
+	target.NumericReply(RPL_STATSCOMMANDS,
+		"%s %d", code, count)
+}
+
+// O <hostmask> * <name>
+func (target *Client) RplStatsOLine(name Name) {
+	target.NumericReply(RPL_STATSOLINE,
+		"O * * %s", name)
+}
+
+func (target *Client) RplStatsUptime(uptime time.Duration) {
+	seconds := uint64(uptime.Seconds())
+	target.NumericReply(RPL_STATSUPTIME,
+		":Server Up %d days %d:%02d:%02d", seconds/86400, (seconds/3600)%24,
+		(seconds/60)%60, seconds%60)
+}
+
+func (target *Client) RplEndOfStats(query rune) {
+	target.NumericReply(RPL_ENDOFSTATS,
+		"%c :End of STATS report", query)
+}
+
 //
 // errors (also numeric)
 //
@@ -533,9 +847,9 @@ func (target *Client) ErrNoSuchServer(server Name) {
 	target.NumericReply(ERR_NOSUCHSERVER, "%s :No such server", server)
 }
 
-func (target *Client) ErrUserNotInChannel(channel *Channel, client *Client) {
+func (target *Client) ErrUserNotInChannel(channel *Channel, nick Name) {
 	target.NumericReply(ERR_USERNOTINCHANNEL,
-		"%s %s :They aren't on that channel", client.Nick(), channel)
+		"%s %s :They aren't on that channel", nick, channel)
 }
 
 func (target *Client) ErrCannotSendToChan(channel *Channel) {
@@ -557,6 +871,11 @@ func (target *Client) ErrNoNicknameGiven() {
 	target.NumericReply(ERR_NONICKNAMEGIVEN, ":No nickname given")
 }
 
+func (target *Client) ErrBadChanName(channel Name) {
+	target.NumericReply(ERR_BADCHANNAME,
+		"%s :Illegal channel name", channel)
+}
+
 func (target *Client) ErrErroneusNickname(nick Name) {
 	target.NumericReply(ERR_ERRONEUSNICKNAME,
 		"%s :Erroneous nickname", nick)
@@ -596,3 +915,115 @@ func (target *Client) ErrInviteOnlyChan(channel *Channel) {
 	target.NumericReply(ERR_INVITEONLYCHAN,
 		"%s :Cannot join channel (+i)", channel)
 }
+
+func (target *Client) ErrNoAdminInfo(server Name) {
+	target.NumericReply(ERR_NOADMININFO,
+		"%s :No administrative info available", server)
+}
+
+func (target *Client) ErrYoureBannedCreep(reason Text) {
+	target.NumericReply(ERR_YOUREBANNEDCREEP,
+		":You are banned from this server (%s)", reason)
+}
+
+func (target *Client) ErrBanNickChange(nick Name, channel *Channel) {
+	target.NumericReply(ERR_BANNICKCHANGE,
+		"%s %s :Cannot change nickname while banned or quieted on channel",
+		nick, channel)
+}
+
+func (target *Client) ErrBadMask(mask Name) {
+	target.NumericReply(ERR_BADMASK,
+		"%s :Invalid ban mask", mask)
+}
+
+func (target *Client) ErrInputTooLong() {
+	target.NumericReply(ERR_INPUTTOOLONG,
+		":Input line was too long")
+}
+
+func (target *Client) ErrSecureOnlyChan(channel *Channel) {
+	target.NumericReply(ERR_SECUREONLYCHAN,
+		"%s :Cannot join channel (+S)", channel)
+}
+
+func (target *Client) ErrNeedReggedNick(channel *Channel) {
+	target.NumericReply(ERR_NEEDREGGEDNICK,
+		"%s :Cannot join channel (+R)", channel)
+}
+
+func (target *Client) ErrLinkChannel(channel *Channel, forward *Channel) {
+	target.NumericReply(ERR_LINKCHANNEL,
+		"%s %s :Forwarding to another channel", channel, forward)
+}
+
+func (target *Client) ErrThrottle(channel *Channel) {
+	target.NumericReply(ERR_THROTTLE,
+		"%s :Cannot join channel (+j) - throttle exceeded, try again later",
+		channel)
+}
+
+// ErrChannelMode sends the reply for a refused MODE change.
+func (target *Client) ErrChannelMode(channel *Channel, err *ChannelModeError) {
+	switch err.code {
+	case ERR_CHANOPRIVSNEEDED:
+		target.ErrChanOPrivIsNeeded(channel)
+	case ERR_NEEDMOREPARAMS:
+		target.ErrNeedMoreParams("MODE")
+	case ERR_NOSUCHNICK:
+		target.ErrNoSuchNick(err.arg)
+	case ERR_USERNOTINCHANNEL:
+		target.ErrUserNotInChannel(channel, err.arg)
+	case ERR_BADMASK:
+		target.ErrBadMask(err.arg)
+	case ERR_NOSUCHCHANNEL:
+		target.ErrNoSuchChannel(err.arg)
+	case ERR_UNKNOWNMODE:
+		target.ErrUnknownMode(ChannelMode([]rune(err.arg.String())[0]), channel)
+	}
+}
+
+// ErrCannotJoin sends the reply for a numeric from Channel.checkJoin.
+func (target *Client) ErrCannotJoin(channel *Channel, code NumericCode) {
+	switch code {
+	case ERR_CHANNELISFULL:
+		target.ErrChannelIsFull(channel)
+	case ERR_BADCHANNELKEY:
+		target.ErrBadChannelKey(channel)
+	case ERR_SECUREONLYCHAN:
+		target.ErrSecureOnlyChan(channel)
+	case ERR_NEEDREGGEDNICK:
+		target.ErrNeedReggedNick(channel)
+	case ERR_INVITEONLYCHAN:
+		target.ErrInviteOnlyChan(channel)
+	case ERR_THROTTLE:
+		target.ErrThrottle(channel)
+	case ERR_BANNEDFROMCHAN:
+		target.ErrBannedFromChan(channel)
+	}
+}
+
+func (target *Client) RplKnock(channel *Channel, client *Client, message Text) {
+	target.NumericReply(RPL_KNOCK,
+		"%s %s :%s", channel, client.UserHost(), message)
+}
+
+func (target *Client) RplKnockDelivered(channel *Channel) {
+	target.NumericReply(RPL_KNOCKDLVR,
+		"%s :Your KNOCK has been delivered.", channel)
+}
+
+func (target *Client) ErrTooManyKnock(channel *Channel, limit string) {
+	target.NumericReply(ERR_TOOMANYKNOCK,
+		"%s :Too many KNOCKs (%s).", channel, limit)
+}
+
+func (target *Client) ErrChanOpen(channel *Channel) {
+	target.NumericReply(ERR_CHANOPEN,
+		"%s :Channel is open.", channel)
+}
+
+func (target *Client) ErrKnockOnChan(channel *Channel) {
+	target.NumericReply(ERR_KNOCKONCHAN,
+		"%s :You're already on that channel.", channel)
+}
@@ -0,0 +1,74 @@
+package irc
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestSplitMessage(t *testing.T) {
+	source := testClient("dan", "dan", "irc.example.com")
+	target := testClient("dave", "dave", "irc.example.com")
+	header := ":dan!dan@irc.example.com PRIVMSG dave :"
+	room := MAX_REPLY_LEN - len(header)
+
+	tests := []struct {
+		what  string
+		text  string
+		lines int
+	}{
+		{"empty", "", 1},
+		{"short", "hello", 1},
+		{"exactly one line", strings.Repeat("x", room), 1},
+		{"one byte over", strings.Repeat("x", room+1), 2},
+		// the line boundary falls inside a character
+		{"two-byte boundary", strings.Repeat("x", room-1) + "é", 2},
+		{"three-byte boundary", strings.Repeat("x", room-2) + "日本", 2},
+		{"four-byte boundary", strings.Repeat("x", room-1) + "😀x", 2},
+		{"many lines", "x" + strings.Repeat("日", room), 4},
+	}
+	for _, test := range tests {
+		replies := splitMessage(source, PRIVMSG, target, Text(test.text))
+		if len(replies) != test.lines {
+			t.Errorf("%s: %d lines, want %d", test.what, len(replies), test.lines)
+		}
+		text := ""
+		for _, reply := range replies {
+			if !strings.HasPrefix(reply, header) {
+				t.Fatalf("%s: %q doesn't start with %q", test.what, reply, header)
+			}
+			if len(reply) > MAX_REPLY_LEN {
+				t.Errorf("%s: %d-byte line", test.what, len(reply))
+			}
+			piece := reply[len(header):]
+			if !utf8.ValidString(piece) {
+				t.Errorf("%s: split a character: %q", test.what, piece)
+			}
+			if (piece == "") && (test.text != "") {
+				t.Errorf("%s: empty line", test.what)
+			}
+			text += piece
+		}
+		if text != test.text {
+			t.Errorf("%s: lines don't add up to the message", test.what)
+		}
+	}
+}
+
+func TestSplitMessageCTCP(t *testing.T) {
+	source := testClient("dan", "dan", "irc.example.com")
+	target := testClient("dave", "dave", "irc.example.com")
+
+	action := "\x01ACTION " + strings.Repeat("é", MAX_REPLY_LEN) + "\x01"
+	replies := splitMessage(source, PRIVMSG, target, Text(action))
+	if len(replies) != 1 {
+		t.Fatalf("CTCP split into %d lines", len(replies))
+	}
+	reply := replies[0]
+	if len(reply) > MAX_REPLY_LEN {
+		t.Errorf("%d-byte line", len(reply))
+	}
+	if !strings.HasSuffix(reply, "é\x01") || !utf8.ValidString(reply) {
+		t.Errorf("CTCP wasn't cut between characters: %q", reply[len(reply)-8:])
+	}
+}
@@ -2,12 +2,13 @@ package irc
 
 import (
 	"bufio"
-	"database/sql"
+	"crypto/tls"
 	"fmt"
 	"log"
 	"net"
 	"os"
 	"os/signal"
+	"runtime"
 	"strings"
 	"syscall"
 	"time"
@@ -24,42 +25,72 @@ type RegServerCommand interface {
 }
 
 type Server struct {
-	channels  ChannelNameMap
-	clients   *ClientLookupSet
-	commands  chan Command
-	ctime     time.Time
-	db        *sql.DB
-	idle      chan *Client
-	motdFile  string
-	name      Name
-	newConns  chan net.Conn
-	operators map[Name][]byte
-	password  []byte
-	signals   chan os.Signal
-	whoWas    *WhoWasList
-	theaters  map[Name][]byte
+	adminEmail     string
+	adminLocation1 string
+	adminLocation2 string
+	bans           map[Name]Text
+	channels       ChannelNameMap
+	channelsByLook map[Name]*Channel // by skeleton
+	clients        *ClientLookupSet
+	commandCounts  map[StringCode]uint64
+	commands       chan Command
+	connections    ClientSet
+	ctime          time.Time
+	drained        chan *Client
+	idle           chan *Client
+	motdFile       string
+	name           Name
+	newConns       chan net.Conn
+	operators      map[Name][]byte
+	password       []byte
+	persister      *Persister
+	registered     map[Name]Name // account names by skeleton
+	scripts        ScriptRestriction
+	signals        chan os.Signal
+	store          Store
+	whoWas         *WhoWasList
+	whoWasPersist  bool
+	theaters       map[Name][]byte
 }
 
+const (
+	MASK_EXPIRE_INTERVAL = 10 * time.Second // how often timed masks are checked
+	SHUTDOWN_TIMEOUT     = 5 * time.Second  // how long to wait for goodbyes to be written
+)
+
 var (
 	SERVER_SIGNALS = []os.Signal{syscall.SIGINT, syscall.SIGHUP,
 		syscall.SIGTERM, syscall.SIGQUIT}
 )
 
-func NewServer(config *Config) *Server {
+// NewServer loads the server's state from `store`. It doesn't accept
+// connections until Listen is called.
+func NewServer(config *Config, store Store) *Server {
 	server := &Server{
-		channels:  make(ChannelNameMap),
-		clients:   NewClientLookupSet(),
-		commands:  make(chan Command),
-		ctime:     time.Now(),
-		db:        OpenDB(config.Server.Database),
-		idle:      make(chan *Client),
-		motdFile:  config.Server.MOTD,
-		name:      NewName(config.Server.Name),
-		newConns:  make(chan net.Conn),
-		operators: config.Operators(),
-		signals:   make(chan os.Signal, len(SERVER_SIGNALS)),
-		whoWas:    NewWhoWasList(100),
-		theaters:  config.Theaters(),
+		adminEmail:     config.Admin.Email,
+		adminLocation1: config.Admin.Location1,
+		adminLocation2: config.Admin.Location2,
+		bans:           config.Bans(),
+		channels:       make(ChannelNameMap),
+		channelsByLook: make(map[Name]*Channel),
+		clients:        NewClientLookupSet(),
+		commandCounts:  make(map[StringCode]uint64),
+		commands:       make(chan Command),
+		connections:    make(ClientSet),
+		ctime:          time.Now(),
+		drained:        make(chan *Client),
+		idle:           make(chan *Client),
+		motdFile:       config.Server.MOTD,
+		name:           NewName(config.Server.Name),
+		newConns:       make(chan net.Conn),
+		operators:      config.Operators(),
+		registered:     make(map[Name]Name),
+		scripts:        config.Scripts(),
+		signals:        make(chan os.Signal, len(SERVER_SIGNALS)),
+		store:          store,
+		whoWas:         NewWhoWasList(config.WhoWas.Size),
+		whoWasPersist:  config.WhoWas.Persist,
+		theaters:       config.Theaters(),
 	}
 
 	if config.Server.Password != "" {
@@ -67,57 +98,118 @@ func NewServer(config *Config) *Server {
 	}
 
 	server.loadChannels()
-
-	for _, addr := range config.Server.Listen {
-		server.listen(addr)
+	server.loadBans()
+	server.loadAccounts()
+	if server.whoWasPersist {
+		server.loadWhoWas()
 	}
-
-	signal.Notify(server.signals, SERVER_SIGNALS...)
+	server.persister = NewPersister(server.store, server.whoWas.Size())
 
 	return server
 }
 
-func loadChannelList(channel *Channel, list string, maskMode ChannelMode) {
-	if list == "" {
-		return
+// Listen accepts connections on the addresses in `config`.
+func (server *Server) Listen(config *Config) {
+	for _, addr := range config.Server.Listen {
+		server.listen(addr, nil)
+	}
+	for addr, tlsConf := range config.TLS {
+		server.listen(addr, tlsConf.Config())
 	}
-	channel.lists[maskMode].AddAll(NewNames(strings.Split(list, " ")))
 }
 
 func (server *Server) loadChannels() {
-	rows, err := server.db.Query(`
-        SELECT name, flags, key, topic, user_limit, ban_list, except_list,
-               invite_list
-          FROM channel`)
+	records, err := server.store.Channels()
 	if err != nil {
 		log.Fatal("error loading channels: ", err)
 	}
-	for rows.Next() {
-		var name, flags, key, topic string
-		var userLimit uint64
-		var banList, exceptList, inviteList string
-		err = rows.Scan(&name, &flags, &key, &topic, &userLimit, &banList,
-			&exceptList, &inviteList)
-		if err != nil {
-			log.Println("Server.loadChannels:", err)
-			continue
-		}
+	for _, record := range records {
+		NewChannelFromRecord(server, record)
+	}
+}
 
-		channel := NewChannel(server, NewName(name))
-		for _, flag := range flags {
-			channel.flags[ChannelMode(flag)] = true
-		}
-		channel.key = NewText(key)
-		channel.topic = NewText(topic)
-		channel.userLimit = userLimit
-		loadChannelList(channel, banList, BanMask)
-		loadChannelList(channel, exceptList, ExceptMask)
-		loadChannelList(channel, inviteList, InviteMask)
+// loadAccounts remembers registered account names, so that nobody else
+// can use a nick that looks like one.
+func (server *Server) loadAccounts() {
+	records, err := server.store.Accounts()
+	if err != nil {
+		log.Fatal("error loading accounts: ", err)
+	}
+	for _, record := range records {
+		server.registered[record.name.Skeleton()] = record.name
+	}
+}
+
+// IsNickConfusable is true if `nick` looks like the nick of a client other
+// than `client`, or like a registered account that `client` isn't logged
+// in to. An account's owner can LOGIN before NICK to take its name.
+func (server *Server) IsNickConfusable(client *Client, nick Name) bool {
+	other := server.clients.GetConfusable(nick)
+	if (other != nil) && (other != client) {
+		return true
+	}
+	account, ok := server.registered[nick.Skeleton()]
+	return ok && (account.ToLower() != client.account.ToLower())
+}
+
+func (server *Server) addChannel(channel *Channel) {
+	server.channels.Add(channel)
+	skeleton := channel.name.Skeleton()
+	if server.channelsByLook[skeleton] == nil {
+		server.channelsByLook[skeleton] = channel
+	}
+}
+
+func (server *Server) removeChannel(channel *Channel) {
+	server.channels.Remove(channel)
+	skeleton := channel.name.Skeleton()
+	if server.channelsByLook[skeleton] == channel {
+		delete(server.channelsByLook, skeleton)
+	}
+}
+
+// IsChannelConfusable is true if `name` looks like an existing channel
+// with a different name.
+func (server *Server) IsChannelConfusable(name Name) bool {
+	other := server.channelsByLook[name.Skeleton()]
+	return (other != nil) && (other.name.ToLower() != name.ToLower())
+}
+
+// loadBans adds stored server bans to those from the config file.
+func (server *Server) loadBans() {
+	records, err := server.store.Bans()
+	if err != nil {
+		log.Fatal("error loading bans: ", err)
+	}
+	for _, record := range records {
+		server.bans[record.mask] = record.reason
+	}
+}
+
+func (server *Server) loadWhoWas() {
+	entries, err := server.store.WhoWas(server.whoWas.Size())
+	if err != nil {
+		log.Fatal("error loading whowas: ", err)
+	}
+	for index := len(entries) - 1; index >= 0; index -= 1 {
+		server.whoWas.Append(entries[index])
+	}
+}
+
+// AddWhoWas remembers a client's identity when it quits or changes nick.
+func (server *Server) AddWhoWas(client *Client) {
+	whoWas := NewWhoWas(client)
+	server.whoWas.Append(whoWas)
+	if server.whoWasPersist {
+		server.persister.AddWhoWas(whoWas)
 	}
 }
 
 func (server *Server) processCommand(cmd Command) {
 	client := cmd.Client()
+	if cmd.Code() != "" {
+		server.commandCounts[cmd.Code()] += 1
+	}
 
 	if !client.registered {
 		regCmd, ok := cmd.(RegServerCommand)
@@ -136,7 +228,7 @@ func (server *Server) processCommand(cmd Command) {
 	}
 
 	switch srvCmd.(type) {
-	case *PingCommand, *PongCommand:
+	case *PingCommand, *PongCommand, *InputTooLongCommand:
 		client.Touch()
 
 	case *QuitCommand:
@@ -150,14 +242,36 @@ func (server *Server) processCommand(cmd Command) {
 	srvCmd.HandleServer(server)
 }
 
+// Shutdown tells every connection that the server is going away, waits up
+// to SHUTDOWN_TIMEOUT for the notices to be written, and then writes out
+// and closes the store.
 func (server *Server) Shutdown() {
-	server.db.Close()
-	for _, client := range server.clients.byNick {
+	for client := range server.connections {
 		client.Reply(RplNotice(server, client, "shutting down"))
+		client.socket.Close()
 	}
+
+	timeout := time.After(SHUTDOWN_TIMEOUT)
+wait:
+	for client := range server.connections {
+		select {
+		case <-client.socket.Done():
+		case <-timeout:
+			break wait
+		}
+	}
+
+	server.persister.Close()
+	server.store.Close()
 }
 
 func (server *Server) Run() {
+	signal.Notify(server.signals, SERVER_SIGNALS...)
+	defer signal.Stop(server.signals)
+
+	expireTicker := time.NewTicker(MASK_EXPIRE_INTERVAL)
+	defer expireTicker.Stop()
+
 	done := false
 	for !done {
 		select {
@@ -173,6 +287,14 @@ func (server *Server) Run() {
 
 		case client := <-server.idle:
 			client.Idle()
+
+		case client := <-server.drained:
+			server.continueList(client)
+
+		case now := <-expireTicker.C:
+			for _, channel := range server.channels {
+				channel.Expire(now)
+			}
 		}
 	}
 }
@@ -181,13 +303,18 @@ func (server *Server) Run() {
 // listen goroutine
 //
 
-func (s *Server) listen(addr string) {
+func (s *Server) listen(addr string, tlsConfig *tls.Config) {
 	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		log.Fatal(s, "listen error: ", err)
 	}
 
-	Log.info.Printf("%s listening on %s", s, addr)
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+		Log.info.Printf("%s listening on %s (TLS)", s, addr)
+	} else {
+		Log.info.Printf("%s listening on %s", s, addr)
+	}
 
 	go func() {
 		for {
@@ -213,14 +340,61 @@ func (s *Server) tryRegister(c *Client) {
 		return
 	}
 
+	for mask, reason := range s.bans {
+		if MatchMask(mask.ToLower(), c.UserHost().ToLower()) {
+			c.ErrYoureBannedCreep(reason)
+			c.Quit(NewText("banned: " + reason.String()))
+			return
+		}
+	}
+
 	c.Register()
 	c.RplWelcome()
 	c.RplYourHost()
 	c.RplCreated()
 	c.RplMyInfo()
+	c.RplISupport(s.ISupport())
+	s.LUsers(c)
 	s.MOTD(c)
 }
 
+// ISupport lists the RPL_ISUPPORT tokens sent on registration.
+func (server *Server) ISupport() []string {
+	tokens := []string{
+		"CASEMAPPING=" + CurrentCaseMapping().String(),
+		"CHANMODES=" + ChannelModeTypes(),
+		"CHANTYPES=&!#+",
+		"ELIST=CMNTU",
+		"EXTBAN=" + ExtBanTypes(),
+		"PREFIX=" + ChannelMemberPrefixes(),
+		"WHOX",
+	}
+	return append(tokens, CurrentLimits().ISupport()...)
+}
+
+func (server *Server) LUsers(client *Client) {
+	var users, invisible, operators, unknown int
+	for member := range server.connections {
+		switch {
+		case !member.registered:
+			unknown += 1
+		case member.flags[Invisible]:
+			invisible += 1
+		default:
+			users += 1
+		}
+		if member.flags[Operator] {
+			operators += 1
+		}
+	}
+
+	client.RplLUserClient(users, invisible)
+	client.RplLUserOp(operators)
+	client.RplLUserUnknown(unknown)
+	client.RplLUserChannels(len(server.channels))
+	client.RplLUserMe(users + invisible)
+}
+
 func (server *Server) MOTD(client *Client) {
 	if server.motdFile == "" {
 		client.ErrNoMOTD()
@@ -243,16 +417,8 @@ func (server *Server) MOTD(client *Client) {
 		}
 		line = strings.TrimRight(line, "\r\n")
 
-		if len(line) > 80 {
-			for len(line) > 80 {
-				client.RplMOTD(line[0:80])
-				line = line[80:]
-			}
-			if len(line) > 0 {
-				client.RplMOTD(line)
-			}
-		} else {
-			client.RplMOTD(line)
+		for _, piece := range splitUTF8(line, 80) {
+			client.RplMOTD(piece)
 		}
 	}
 	client.RplMOTDEnd()
@@ -294,7 +460,12 @@ func (msg *PassCommand) HandleRegServer(server *Server) {
 }
 
 func (msg *ProxyCommand) HandleRegServer(server *Server) {
-	msg.Client().hostname = msg.hostname
+	client := msg.Client()
+	client.hostname = msg.hostname
+	if msg.sourceIP != "" {
+		client.ip = msg.sourceIP
+	}
+	server.clients.Update(client)
 }
 
 func (msg *RFC1459UserCommand) HandleRegServer(server *Server) {
@@ -330,13 +501,16 @@ func (msg *UserCommand) setUserInfo(server *Server) {
 		client.capState = CapNegotiated
 	}
 
-	server.clients.Remove(client)
 	client.username, client.realname = msg.username, msg.realname
-	server.clients.Add(client)
+	server.clients.Update(client)
 
 	server.tryRegister(client)
 }
 
+func (msg *InputTooLongCommand) HandleRegServer(server *Server) {
+	msg.Client().ErrInputTooLong()
+}
+
 func (msg *QuitCommand) HandleRegServer(server *Server) {
 	msg.Client().Quit(msg.message)
 }
@@ -349,6 +523,10 @@ func (m *PassCommand) HandleServer(s *Server) {
 	m.Client().ErrAlreadyRegistered()
 }
 
+func (msg *InputTooLongCommand) HandleServer(server *Server) {
+	msg.Client().ErrInputTooLong()
+}
+
 func (m *PingCommand) HandleServer(s *Server) {
 	client := m.Client()
 	client.Reply(RplPong(client, m.server.Text()))
@@ -378,12 +556,21 @@ func (m *JoinCommand) HandleServer(s *Server) {
 
 	for name, key := range m.channels {
 		if !name.IsChannel() {
-			client.ErrNoSuchChannel(name)
+			// a channel name that is only too long is a bad name
+			if ChannelNameExpr.MatchString(name.String()) {
+				client.ErrBadChanName(name)
+			} else {
+				client.ErrNoSuchChannel(name)
+			}
 			continue
 		}
 
 		channel := s.channels.Get(name)
 		if channel == nil {
+			if !s.scripts.Allows(name) || s.IsChannelConfusable(name) {
+				client.ErrBadChanName(name)
+				continue
+			}
 			channel = NewChannel(s, name)
 		}
 		channel.Join(client, key)
@@ -437,27 +624,25 @@ func (msg *PrivMsgCommand) HandleServer(server *Server) {
 		client.ErrNoSuchNick(msg.target)
 		return
 	}
-	target.Reply(RplPrivMsg(client, target, msg.message))
+	for _, reply := range RplPrivMsgs(client, target, msg.message) {
+		target.Reply(reply)
+	}
 	if target.flags[Away] {
 		client.RplAway(target)
 	}
 }
 
-func (client *Client) WhoisChannelsNames() []string {
-	chstrs := make([]string, len(client.channels))
-	index := 0
+// WhoisChannelsNames lists the channels of `client` that are visible
+// to `target`, with membership prefixes.
+func (client *Client) WhoisChannelsNames(target *Client) []string {
+	isMultiPrefix := target.capabilities[MultiPrefix]
+	chstrs := make([]string, 0, len(client.channels))
 	for channel := range client.channels {
-		switch {
-		case channel.members[client][ChannelOperator]:
-			chstrs[index] = "@" + channel.name.String()
-
-		case channel.members[client][Voice]:
-			chstrs[index] = "+" + channel.name.String()
-
-		default:
-			chstrs[index] = channel.name.String()
+		if !channel.IsVisibleTo(target) {
+			continue
 		}
-		index += 1
+		chstrs = append(chstrs,
+			channel.members[client].Prefixes(isMultiPrefix)+channel.name.String())
 	}
 	return chstrs
 }
@@ -465,12 +650,19 @@ func (client *Client) WhoisChannelsNames() []string {
 func (m *WhoisCommand) HandleServer(server *Server) {
 	client := m.Client()
 
-	// TODO implement target query
+	// There is only one server, so a target is either its name or the nick
+	// of a client connected to it.
+	if (m.target != "") && (m.target != server.name) &&
+		(server.clients.Get(m.target) == nil) {
+		client.ErrNoSuchServer(m.target)
+		return
+	}
 
 	for _, mask := range m.masks {
 		matches := server.clients.FindAll(mask)
 		if len(matches) == 0 {
 			client.ErrNoSuchNick(mask)
+			client.RplEndOfWhois(mask)
 			continue
 		}
 		for mclient := range matches {
@@ -479,10 +671,47 @@ func (m *WhoisCommand) HandleServer(server *Server) {
 	}
 }
 
-func whoChannel(client *Client, channel *Channel, friends ClientSet) {
+func (msg *UserHostCommand) HandleServer(server *Server) {
+	client := msg.Client()
+
+	replies := make([]string, 0, len(msg.nicknames))
+	for _, nickname := range msg.nicknames {
+		target := server.clients.Get(nickname)
+		if target == nil {
+			continue
+		}
+		replies = append(replies, target.UserHostReply())
+	}
+	client.RplUserHost(replies)
+}
+
+// shows reports whether `member` belongs in the WHO reply for `client`.
+// Invisible users are only shown to opers and to clients that share a
+// channel with them.
+func (msg *WhoCommand) shows(client *Client, member *Client, friends ClientSet) bool {
+	if msg.operatorOnly && !member.flags[Operator] {
+		return false
+	}
+	return !member.flags[Invisible] || friends[member] || client.flags[Operator]
+}
+
+func (msg *WhoCommand) reply(channel *Channel, member *Client) {
+	client := msg.Client()
+	if msg.whox {
+		client.RplWhoxReply(channel, member, msg.fields, msg.token)
+	} else {
+		client.RplWhoReply(channel, member)
+	}
+}
+
+func (msg *WhoCommand) whoChannel(channel *Channel, friends ClientSet) {
+	client := msg.Client()
+	if !channel.IsVisibleTo(client) {
+		return
+	}
 	for member := range channel.members {
-		if !client.flags[Invisible] || friends[client] {
-			client.RplWhoReply(channel, member)
+		if msg.shows(client, member, friends) {
+			msg.reply(channel, member)
 		}
 	}
 }
@@ -494,17 +723,25 @@ func (msg *WhoCommand) HandleServer(server *Server) {
 
 	if mask == "" {
 		for _, channel := range server.channels {
-			whoChannel(client, channel, friends)
+			msg.whoChannel(channel, friends)
 		}
 	} else if mask.IsChannel() {
-		// TODO implement wildcard matching
 		channel := server.channels.Get(mask)
 		if channel != nil {
-			whoChannel(client, channel, friends)
+			msg.whoChannel(channel, friends)
+		}
+	} else if mask.IsChannelMask() {
+		lowerMask := mask.ToLower()
+		for name, channel := range server.channels {
+			if MatchMask(lowerMask, name) {
+				msg.whoChannel(channel, friends)
+			}
 		}
 	} else {
 		for mclient := range server.clients.FindAll(mask) {
-			client.RplWhoReply(nil, mclient)
+			if msg.shows(client, mclient, friends) {
+				msg.reply(nil, mclient)
+			}
 		}
 	}
 
@@ -527,6 +764,26 @@ func (msg *OperCommand) HandleServer(server *Server) {
 	}}))
 }
 
+func (msg *LoginCommand) HandleRegServer(server *Server) {
+	msg.login()
+}
+
+func (msg *LoginCommand) HandleServer(server *Server) {
+	msg.login()
+}
+
+func (msg *LoginCommand) login() {
+	client := msg.Client()
+
+	if (msg.hash == nil) || (msg.err != nil) {
+		client.ErrPasswdMismatch()
+		return
+	}
+
+	client.account = msg.account.name
+	client.RplLoggedIn()
+}
+
 func (msg *AwayCommand) HandleServer(server *Server) {
 	client := msg.Client()
 	if len(msg.text) > 0 {
@@ -585,7 +842,9 @@ func (msg *NoticeCommand) HandleServer(server *Server) {
 		client.ErrNoSuchNick(msg.target)
 		return
 	}
-	target.Reply(RplNotice(client, target, msg.message))
+	for _, reply := range RplNotices(client, target, msg.message) {
+		target.Reply(reply)
+	}
 }
 
 func (msg *KickCommand) HandleServer(server *Server) {
@@ -607,40 +866,13 @@ func (msg *KickCommand) HandleServer(server *Server) {
 	}
 }
 
-func (msg *ListCommand) HandleServer(server *Server) {
+func (msg *NamesCommand) HandleServer(server *Server) {
 	client := msg.Client()
-
-	// TODO target server
-	if msg.target != "" {
-		client.ErrNoSuchServer(msg.target)
-		return
-	}
-
 	if len(msg.channels) == 0 {
 		for _, channel := range server.channels {
-			if !client.flags[Operator] && channel.flags[Private] {
-				continue
-			}
-			client.RplList(channel)
-		}
-	} else {
-		for _, chname := range msg.channels {
-			channel := server.channels.Get(chname)
-			if channel == nil || (!client.flags[Operator] && channel.flags[Private]) {
-				client.ErrNoSuchChannel(chname)
-				continue
+			if channel.IsVisibleTo(client) {
+				channel.Names(client)
 			}
-			client.RplList(channel)
-		}
-	}
-	client.RplListEnd(server)
-}
-
-func (msg *NamesCommand) HandleServer(server *Server) {
-	client := msg.Client()
-	if len(server.channels) == 0 {
-		for _, channel := range server.channels {
-			channel.Names(client)
 		}
 		return
 	}
@@ -684,6 +916,18 @@ func (msg *InviteCommand) HandleServer(server *Server) {
 	channel.Invite(target, client)
 }
 
+func (msg *KnockCommand) HandleServer(server *Server) {
+	client := msg.Client()
+
+	channel := server.channels.Get(msg.channel)
+	if (channel == nil) || !channel.IsVisibleTo(client) {
+		client.ErrNoSuchChannel(msg.channel)
+		return
+	}
+
+	channel.Knock(client, msg.message)
+}
+
 func (msg *TimeCommand) HandleServer(server *Server) {
 	client := msg.Client()
 	if (msg.target != "") && (msg.target != server.name) {
@@ -712,6 +956,11 @@ func (msg *KillCommand) HandleServer(server *Server) {
 
 func (msg *WhoWasCommand) HandleServer(server *Server) {
 	client := msg.Client()
+	if (msg.target != "") && (msg.target.ToLower() != server.name.ToLower()) {
+		client.ErrNoSuchServer(msg.target)
+		return
+	}
+
 	for _, nickname := range msg.nicknames {
 		results := server.whoWas.Find(nickname, msg.count)
 		if len(results) == 0 {
@@ -719,8 +968,111 @@ func (msg *WhoWasCommand) HandleServer(server *Server) {
 		} else {
 			for _, whoWas := range results {
 				client.RplWhoWasUser(whoWas)
+				client.RplWhoWasServer(whoWas)
+				if client.flags[Operator] {
+					client.RplWhoWasActually(whoWas)
+				}
 			}
 		}
 		client.RplEndOfWhoWas(nickname)
 	}
 }
+
+func (msg *LUsersCommand) HandleServer(server *Server) {
+	client := msg.Client()
+	if (msg.target != "") && (msg.target != server.name) {
+		client.ErrNoSuchServer(msg.target)
+		return
+	}
+	server.LUsers(client)
+}
+
+func (msg *AdminCommand) HandleServer(server *Server) {
+	client := msg.Client()
+	if (msg.target != "") && (msg.target != server.name) {
+		client.ErrNoSuchServer(msg.target)
+		return
+	}
+
+	if (server.adminLocation1 == "") && (server.adminLocation2 == "") &&
+		(server.adminEmail == "") {
+		client.ErrNoAdminInfo(server.name)
+		return
+	}
+	client.RplAdminMe()
+	client.RplAdminLoc1(server.adminLocation1)
+	client.RplAdminLoc2(server.adminLocation2)
+	client.RplAdminEmail(server.adminEmail)
+}
+
+func (msg *InfoCommand) HandleServer(server *Server) {
+	client := msg.Client()
+	if (msg.target != "") && (msg.target != server.name) {
+		client.ErrNoSuchServer(msg.target)
+		return
+	}
+
+	client.RplInfo(SEM_VER)
+	client.RplInfo(fmt.Sprintf("built with %s for %s/%s", runtime.Version(),
+		runtime.GOOS, runtime.GOARCH))
+	client.RplInfo("on-line since " + server.ctime.Format(time.RFC1123))
+	client.RplEndOfInfo()
+}
+
+func (msg *StatsCommand) HandleServer(server *Server) {
+	client := msg.Client()
+	if (msg.target != "") && (msg.target != server.name) {
+		client.ErrNoSuchServer(msg.target)
+		return
+	}
+
+	switch msg.query {
+	case 'k', 'K':
+		if !client.flags[Operator] {
+			client.ErrNoPrivileges()
+			return
+		}
+		for mask, reason := range server.bans {
+			client.RplStatsKLine(mask, reason)
+		}
+
+	case 'l', 'L':
+		if !client.flags[Operator] {
+			client.ErrNoPrivileges()
+			return
+		}
+		for member := range server.connections {
+			client.RplStatsLinkInfo(member)
+		}
+
+	case 'm', 'M':
+		for code, count := range server.commandCounts {
+			client.RplStatsCommands(code, count)
+		}
+
+	case 'o', 'O':
+		if !client.flags[Operator] {
+			client.ErrNoPrivileges()
+			return
+		}
+		for name := range server.operators {
+			client.RplStatsOLine(name)
+		}
+
+	case 'u', 'U':
+		client.RplStatsUptime(time.Since(server.ctime))
+	}
+
+	client.RplEndOfStats(msg.query)
+}
+
+func (msg *TimedBanCommand) HandleServer(server *Server) {
+	client := msg.Client()
+	channel := server.channels.Get(msg.channel)
+	if channel == nil {
+		client.ErrNoSuchChannel(msg.channel)
+		return
+	}
+
+	channel.TimedBan(client, msg.mask, msg.duration)
+}
@@ -0,0 +1,202 @@
+package irc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const TEST_TIMEOUT = 5 * time.Second
+
+func newTestServer(store Store) *Server {
+	config := &Config{}
+	config.Server.Name = "irc.example.com"
+	config.WhoWas.Size = 10
+	return NewServer(config, store)
+}
+
+// runTestServer runs `server` until the returned function stops it.
+func runTestServer(t *testing.T, server *Server) func() {
+	done := make(chan struct{})
+	go func() {
+		server.Run()
+		close(done)
+	}()
+	return func() {
+		server.signals <- syscall.SIGTERM
+		select {
+		case <-done:
+		case <-time.After(2 * SHUTDOWN_TIMEOUT):
+			t.Fatal("server didn't stop")
+		}
+	}
+}
+
+// testConn is the client's end of a connection to a test server.
+type testConn struct {
+	t      *testing.T
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func connectTestClient(t *testing.T, server *Server, nick string) *testConn {
+	serverConn, clientConn := net.Pipe()
+	server.newConns <- serverConn
+	conn := &testConn{
+		t:      t,
+		conn:   clientConn,
+		reader: bufio.NewReader(clientConn),
+	}
+	conn.Send("NICK " + nick)
+	conn.Send("USER " + nick + " 0 * :" + nick)
+	conn.Expect(" " + RPL_WELCOME.String() + " ")
+	return conn
+}
+
+func (conn *testConn) Send(line string) {
+	conn.conn.SetWriteDeadline(time.Now().Add(TEST_TIMEOUT))
+	if _, err := fmt.Fprint(conn.conn, line+CRLF); err != nil {
+		conn.t.Fatalf("send %q: %s", line, err)
+	}
+}
+
+// Expect reads replies until one contains `substr`.
+func (conn *testConn) Expect(substr string) string {
+	conn.conn.SetReadDeadline(time.Now().Add(TEST_TIMEOUT))
+	for {
+		line, err := conn.reader.ReadString('\n')
+		if err != nil {
+			conn.t.Fatalf("expecting %q: %s", substr, err)
+		}
+		if strings.Contains(line, substr) {
+			return line
+		}
+	}
+}
+
+// Drain discards the rest of the replies, so the server can say goodbye.
+func (conn *testConn) Drain() {
+	conn.conn.SetReadDeadline(time.Time{})
+	go io.Copy(ioutil.Discard, conn.conn)
+}
+
+func TestPersistentChannelSurvivesRestart(t *testing.T) {
+	store := NewMemoryStore()
+
+	server := newTestServer(store)
+	stop := runTestServer(t, server)
+	conn := connectTestClient(t, server, "dan")
+	conn.Send("JOIN #persist")
+	conn.Expect("JOIN #persist")
+	conn.Send("TOPIC #persist :still here")
+	conn.Expect("TOPIC #persist")
+	conn.Send("MODE #persist +P")
+	conn.Expect("MODE #persist +P")
+	conn.Send("PART #persist")
+	conn.Expect("PART #persist")
+	conn.Drain()
+	stop()
+
+	server = newTestServer(store)
+	channel := server.channels.Get("#PERSIST")
+	if channel == nil {
+		t.Fatal("#persist wasn't reloaded")
+	}
+	if !channel.flags[Persistent] {
+		t.Error("#persist was reloaded without +P")
+	}
+	if channel.topic != "still here" {
+		t.Errorf("#persist topic = %q, want %q", channel.topic, "still here")
+	}
+
+	stop = runTestServer(t, server)
+	defer stop()
+	conn = connectTestClient(t, server, "dave")
+	defer conn.Drain()
+	conn.Send("JOIN #persist")
+	conn.Expect(" " + RPL_TOPIC.String() + " dave #persist :still here")
+}
+
+// newTestSQLiteStore creates a database in a directory that the returned
+// function removes.
+func newTestSQLiteStore(t *testing.T) (*SQLiteStore, func()) {
+	dir, err := ioutil.TempDir("", "ergonomadic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "ergonomadic.db")
+	InitDB(path, false)
+	store := NewSQLiteStore(path)
+	return store, func() {
+		store.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestStoreAccountsIgnoreCase(t *testing.T) {
+	sqliteStore, cleanup := newTestSQLiteStore(t)
+	defer cleanup()
+	stores := map[string]Store{
+		"memory": NewMemoryStore(),
+		"sqlite": sqliteStore,
+	}
+	for kind, store := range stores {
+		err := store.SaveAccount(&AccountRecord{name: "Dan"})
+		if err != nil {
+			t.Fatalf("%s: %s", kind, err)
+		}
+		err = store.SaveAccount(&AccountRecord{name: "dan", passwordHash: []byte("x")})
+		if err != nil {
+			t.Fatalf("%s: %s", kind, err)
+		}
+
+		records, err := store.Accounts()
+		if err != nil {
+			t.Fatalf("%s: %s", kind, err)
+		}
+		if len(records) != 1 {
+			t.Errorf("%s: %d accounts, want 1", kind, len(records))
+		}
+		record, err := store.Account("DAN")
+		if err != nil {
+			t.Fatalf("%s: %s", kind, err)
+		}
+		if (record == nil) || (string(record.passwordHash) != "x") {
+			t.Errorf("%s: Account(DAN) = %v", kind, record)
+		}
+
+		if err := store.DeleteAccount("DaN"); err != nil {
+			t.Fatalf("%s: %s", kind, err)
+		}
+		if record, _ := store.Account("dan"); record != nil {
+			t.Errorf("%s: account wasn't deleted", kind)
+		}
+	}
+}
+
+func TestJoinChannelNameErrors(t *testing.T) {
+	server := newTestServer(NewMemoryStore())
+	stop := runTestServer(t, server)
+	defer stop()
+	conn := connectTestClient(t, server, "dan")
+	defer conn.Drain()
+
+	long := "#" + strings.Repeat("x", limits.ChannelLen)
+	conn.Send("JOIN " + long)
+	conn.Expect(" " + ERR_BADCHANNAME.String() + " dan " + long + " ")
+	conn.Send("JOIN nochannel")
+	conn.Expect(" " + ERR_NOSUCHCHANNEL.String() + " dan nochannel ")
+
+	// names are measured in characters, not bytes
+	wide := "#" + strings.Repeat("é", limits.ChannelLen-1)
+	conn.Send("JOIN " + wide)
+	conn.Expect("JOIN " + wide)
+}
@@ -2,72 +2,206 @@ package irc
 
 import (
 	"bufio"
+	"errors"
 	"io"
 	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 const (
 	R = '→'
 	W = '←'
+
+	SEND_QUEUE_LEN = 1024             // lines buffered before the client is dropped
+	WRITE_TIMEOUT  = 30 * time.Second // how long a peer may take to accept a line
+)
+
+var (
+	ErrInputTooLong  = errors.New("input line too long")
+	ErrSendQExceeded = errors.New("send queue exceeded")
 )
 
 type Socket struct {
-	closed  bool
-	conn    net.Conn
-	scanner *bufio.Scanner
-	writer  *bufio.Writer
+	closed        bool
+	conn          net.Conn
+	ctime         time.Time
+	done          chan struct{}
+	drainCallback func()
+	mutex         sync.Mutex
+	queue         chan string
+	reader        *bufio.Reader
+	writer        *bufio.Writer
+
+	// traffic counters, updated atomically by the reading and writing
+	// goroutines
+	queuedBytes      int64
+	receivedBytes    uint64
+	receivedMessages uint64
+	sentBytes        uint64
+	sentMessages     uint64
 }
 
 func NewSocket(conn net.Conn) *Socket {
-	return &Socket{
-		conn:    conn,
-		scanner: bufio.NewScanner(conn),
-		writer:  bufio.NewWriter(conn),
+	socket := &Socket{
+		conn:   conn,
+		ctime:  time.Now(),
+		done:   make(chan struct{}),
+		queue:  make(chan string, SEND_QUEUE_LEN),
+		reader: bufio.NewReader(conn),
+		writer: bufio.NewWriter(conn),
 	}
+	go socket.writeLoop()
+	return socket
 }
 
 func (socket *Socket) String() string {
 	return socket.conn.RemoteAddr().String()
 }
 
+// Close stops accepting new lines. The connection is closed once the lines
+// already queued have been written, or as soon as a write times out.
 func (socket *Socket) Close() {
+	socket.mutex.Lock()
+	defer socket.mutex.Unlock()
+
 	if socket.closed {
 		return
 	}
 	socket.closed = true
-	socket.conn.Close()
-	Log.debug.Printf("%s closed", socket)
+	close(socket.queue)
 }
 
+// Read returns the next non-empty line. Lines longer than the protocol
+// allows are skipped and reported with ErrInputTooLong; reading can go on
+// after that error.
 func (socket *Socket) Read() (line string, err error) {
-	if socket.closed {
+	if socket.isClosed() {
 		err = io.EOF
 		return
 	}
 
-	for socket.scanner.Scan() {
-		line = socket.scanner.Text()
+	for {
+		line, err = socket.readLine()
+		if err == ErrInputTooLong {
+			Log.debug.Printf("%s → (line too long)", socket)
+			return
+		}
+		if socket.isError(err, R) {
+			return
+		}
 		if len(line) == 0 {
 			continue
 		}
+		atomic.AddUint64(&socket.receivedMessages, 1)
+		atomic.AddUint64(&socket.receivedBytes, uint64(len(line)+len(CRLF)))
 		Log.debug.Printf("%s → %s", socket, line)
 		return
 	}
+}
 
-	err = socket.scanner.Err()
-	socket.isError(err, R)
-	if err == nil {
-		err = io.EOF
+// readLine reads up to the next LF or CRLF. Once a line is known to be too
+// long, the rest of it is discarded as it arrives.
+func (socket *Socket) readLine() (string, error) {
+	line := make([]byte, 0)
+	tooLong := false
+	for {
+		chunk, isPrefix, err := socket.reader.ReadLine()
+		if err != nil {
+			return "", err
+		}
+		if !tooLong {
+			line = append(line, chunk...)
+			tooLong = len(line) > (MAX_TAGS_LEN + MAX_INPUT_LEN)
+		}
+		if !isPrefix {
+			break
+		}
 	}
-	return
+	if tooLong || IsInputTooLong(string(line)) {
+		return "", ErrInputTooLong
+	}
+	return string(line), nil
+}
+
+// IsInputTooLong checks a line without its CRLF. Message tags may take up
+// MAX_TAGS_LEN bytes on top of MAX_INPUT_LEN for the rest of the line.
+func IsInputTooLong(line string) bool {
+	if strings.HasPrefix(line, "@") {
+		tagsLen := len(line)
+		if space := strings.Index(line, " "); space >= 0 {
+			tagsLen = space + 1
+		}
+		if tagsLen > MAX_TAGS_LEN {
+			return true
+		}
+		line = line[tagsLen:]
+	}
+	return len(line) > MAX_INPUT_LEN
 }
 
+// Write queues a line for the writer goroutine. It never blocks: a peer
+// that lets the send queue fill up isn't reading, so its connection is
+// closed and the line is dropped.
 func (socket *Socket) Write(line string) (err error) {
+	socket.mutex.Lock()
+	defer socket.mutex.Unlock()
+
 	if socket.closed {
 		err = io.EOF
 		return
 	}
 
+	size := int64(len(line) + len(CRLF))
+	atomic.AddInt64(&socket.queuedBytes, size)
+	select {
+	case socket.queue <- line:
+	default:
+		atomic.AddInt64(&socket.queuedBytes, -size)
+		Log.debug.Printf("%s ← (send queue full)", socket)
+		socket.closed = true
+		close(socket.queue)
+		socket.conn.Close()
+		err = ErrSendQExceeded
+	}
+	return
+}
+
+// Done is closed once the writer goroutine has finished and the connection
+// is closed.
+func (socket *Socket) Done() <-chan struct{} {
+	return socket.done
+}
+
+//
+// writer goroutine
+//
+
+func (socket *Socket) writeLoop() {
+	var err error
+	for line := range socket.queue {
+		if err == nil {
+			err = socket.write(line)
+		}
+		atomic.AddInt64(&socket.queuedBytes, -int64(len(line)+len(CRLF)))
+		socket.checkDrained()
+	}
+
+	socket.conn.Close()
+	Log.debug.Printf("%s closed", socket)
+	close(socket.done)
+}
+
+// write gives up after WRITE_TIMEOUT, so a peer that stops reading can't
+// keep the connection open once it has been closed.
+func (socket *Socket) write(line string) (err error) {
+	err = socket.conn.SetWriteDeadline(time.Now().Add(WRITE_TIMEOUT))
+	if socket.isError(err, W) {
+		return
+	}
+
 	if _, err = socket.writer.WriteString(line); socket.isError(err, W) {
 		return
 	}
@@ -80,10 +214,62 @@ func (socket *Socket) Write(line string) (err error) {
 		return
 	}
 
+	atomic.AddUint64(&socket.sentMessages, 1)
+	atomic.AddUint64(&socket.sentBytes, uint64(len(line)+len(CRLF)))
 	Log.debug.Printf("%s ← %s", socket, line)
 	return
 }
 
+// WhenDrained arranges for `callback` to be called once every queued line
+// has been written. It replaces any callback that has not fired yet. The
+// callback runs on the writer goroutine and must not block.
+func (socket *Socket) WhenDrained(callback func()) {
+	socket.mutex.Lock()
+	socket.drainCallback = callback
+	socket.mutex.Unlock()
+	socket.checkDrained()
+}
+
+func (socket *Socket) checkDrained() {
+	// Write takes the mutex for every line, so only take it once there is
+	// nothing left to write.
+	if atomic.LoadInt64(&socket.queuedBytes) != 0 {
+		return
+	}
+
+	socket.mutex.Lock()
+	var callback func()
+	if atomic.LoadInt64(&socket.queuedBytes) == 0 {
+		callback = socket.drainCallback
+		socket.drainCallback = nil
+	}
+	socket.mutex.Unlock()
+
+	if callback != nil {
+		callback()
+	}
+}
+
+// SendQ is the number of bytes waiting to be written to the connection.
+func (socket *Socket) SendQ() int64 {
+	return atomic.LoadInt64(&socket.queuedBytes)
+}
+
+func (socket *Socket) Sent() (messages uint64, bytes uint64) {
+	return atomic.LoadUint64(&socket.sentMessages), atomic.LoadUint64(&socket.sentBytes)
+}
+
+func (socket *Socket) Received() (messages uint64, bytes uint64) {
+	return atomic.LoadUint64(&socket.receivedMessages),
+		atomic.LoadUint64(&socket.receivedBytes)
+}
+
+func (socket *Socket) isClosed() bool {
+	socket.mutex.Lock()
+	defer socket.mutex.Unlock()
+	return socket.closed
+}
+
 func (socket *Socket) isError(err error, dir rune) bool {
 	if err != nil {
 		if err != io.EOF {
@@ -0,0 +1,379 @@
+package irc
+
+import (
+	"database/sql"
+)
+
+// SQLiteStore is a Store backed by the sqlite database created by `initdb`.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens the database at `path` and checks that its schema
+// is up to date.
+func NewSQLiteStore(path string) *SQLiteStore {
+	db := OpenDB(path)
+	CheckDB(db)
+	return &SQLiteStore{
+		db: db,
+	}
+}
+
+// inTransaction runs `f` in a transaction that is committed if `f`
+// succeeds and rolled back otherwise.
+func (store *SQLiteStore) inTransaction(f func(*sql.Tx) error) error {
+	return inTransaction(store.db, f)
+}
+
+func (store *SQLiteStore) Channels() (records []*ChannelRecord, err error) {
+	rows, err := store.db.Query(`
+        SELECT name, name_key, flags, key, topic, topic_set_by, topic_time,
+               created_time, user_limit, join_throttle, forward
+          FROM channel`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	byKey := make(map[string]*ChannelRecord)
+	for rows.Next() {
+		var name, nameKey, flags, key, topic, topicSetBy, joinThrottle, forward string
+		var topicTime, createdTime int64
+		var userLimit uint64
+		err = rows.Scan(&name, &nameKey, &flags, &key, &topic, &topicSetBy,
+			&topicTime, &createdTime, &userLimit, &joinThrottle, &forward)
+		if err != nil {
+			return
+		}
+
+		record := &ChannelRecord{
+			ctime:        fromUnixTime(createdTime),
+			flags:        make(ChannelModes, 0, len(flags)),
+			forward:      NewName(forward),
+			joinThrottle: joinThrottle,
+			key:          NewText(key),
+			masks:        make(map[ChannelMode][]*UserMask),
+			name:         NewName(name),
+			topic:        NewText(topic),
+			topicSetBy:   NewName(topicSetBy),
+			topicTime:    fromUnixTime(topicTime),
+			userLimit:    userLimit,
+		}
+		for _, flag := range flags {
+			record.flags = append(record.flags, ChannelMode(flag))
+		}
+		records = append(records, record)
+		byKey[nameKey] = record
+	}
+	if err = rows.Err(); err != nil {
+		return
+	}
+
+	err = store.loadChannelMasks(byKey)
+	return
+}
+
+// loadChannelMasks adds mask lists to channels, keyed by folded name.
+func (store *SQLiteStore) loadChannelMasks(byKey map[string]*ChannelRecord) error {
+	rows, err := store.db.Query(`
+        SELECT channel, mode, mask, set_by, set_time, expires
+          FROM channel_mask`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var chname, mode, mask, setBy string
+		var setTime, expires int64
+		err = rows.Scan(&chname, &mode, &mask, &setBy, &setTime, &expires)
+		if err != nil {
+			return err
+		}
+
+		record := byKey[chname]
+		if (record == nil) || (len(mode) == 0) {
+			continue
+		}
+		listMode := ChannelMode([]rune(mode)[0])
+		record.masks[listMode] = append(record.masks[listMode], &UserMask{
+			mask:    NewName(mask),
+			setBy:   NewName(setBy),
+			setTime: fromUnixTime(setTime),
+			expires: fromUnixTime(expires),
+		})
+	}
+	return rows.Err()
+}
+
+func (store *SQLiteStore) SaveChannel(record *ChannelRecord) error {
+	return store.inTransaction(func(tx *sql.Tx) error {
+		return saveChannel(tx, record)
+	})
+}
+
+func saveChannel(tx *sql.Tx, record *ChannelRecord) error {
+	_, err := tx.Exec(`
+        DELETE FROM channel_mask WHERE channel = ?`, record.name.ToLower().String())
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+        INSERT OR REPLACE INTO channel
+          (name, name_key, flags, key, topic, topic_set_by, topic_time,
+           created_time, user_limit, join_throttle, forward)
+          VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		record.name.String(), record.name.ToLower().String(),
+		record.flags.String(), record.key.String(),
+		record.topic.String(), record.topicSetBy.String(),
+		unixTime(record.topicTime), unixTime(record.ctime),
+		record.userLimit, record.joinThrottle, record.forward.String())
+	if err != nil {
+		return err
+	}
+
+	for mode, masks := range record.masks {
+		for _, mask := range masks {
+			_, err = tx.Exec(`
+                INSERT INTO channel_mask
+                  (channel, mode, mask, set_by, set_time, expires)
+                  VALUES (?, ?, ?, ?, ?, ?)`,
+				record.name.ToLower().String(), mode.String(), mask.mask.String(),
+				mask.setBy.String(), unixTime(mask.setTime),
+				unixTime(mask.expires))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (store *SQLiteStore) DeleteChannel(name Name) error {
+	return store.inTransaction(func(tx *sql.Tx) error {
+		return deleteChannel(tx, name)
+	})
+}
+
+func deleteChannel(tx *sql.Tx, name Name) error {
+	_, err := tx.Exec(`
+        DELETE FROM channel_mask WHERE channel = ?`, name.ToLower().String())
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+        DELETE FROM channel WHERE name_key = ?`, name.ToLower().String())
+	return err
+}
+
+func (store *SQLiteStore) UpdateChannels(saves []*ChannelRecord,
+	deletes []Name) error {
+	return store.inTransaction(func(tx *sql.Tx) error {
+		for _, record := range saves {
+			if err := saveChannel(tx, record); err != nil {
+				return err
+			}
+		}
+		for _, name := range deletes {
+			if err := deleteChannel(tx, name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (store *SQLiteStore) Accounts() (records []*AccountRecord, err error) {
+	rows, err := store.db.Query(`
+        SELECT name, password_hash, created_time FROM account`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name string
+		var passwordHash []byte
+		var createdTime int64
+		if err = rows.Scan(&name, &passwordHash, &createdTime); err != nil {
+			return
+		}
+		records = append(records, &AccountRecord{
+			ctime:        fromUnixTime(createdTime),
+			name:         NewName(name),
+			passwordHash: passwordHash,
+		})
+	}
+	err = rows.Err()
+	return
+}
+
+func (store *SQLiteStore) Account(name Name) (*AccountRecord, error) {
+	var storedName string
+	var passwordHash []byte
+	var createdTime int64
+	err := store.db.QueryRow(`
+        SELECT name, password_hash, created_time FROM account
+          WHERE name_key = ?`,
+		name.ToLower().String()).Scan(&storedName, &passwordHash, &createdTime)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &AccountRecord{
+		ctime:        fromUnixTime(createdTime),
+		name:         NewName(storedName),
+		passwordHash: passwordHash,
+	}, nil
+}
+
+func (store *SQLiteStore) SaveAccount(record *AccountRecord) error {
+	return store.inTransaction(func(tx *sql.Tx) error {
+		return saveAccount(tx, record)
+	})
+}
+
+func saveAccount(tx *sql.Tx, record *AccountRecord) error {
+	_, err := tx.Exec(`
+        INSERT OR REPLACE INTO account
+          (name, name_key, password_hash, created_time)
+          VALUES (?, ?, ?, ?)`,
+		record.name.String(), record.name.ToLower().String(),
+		record.passwordHash, unixTime(record.ctime))
+	return err
+}
+
+func (store *SQLiteStore) DeleteAccount(name Name) error {
+	_, err := store.db.Exec(`
+        DELETE FROM account WHERE name_key = ?`, name.ToLower().String())
+	return err
+}
+
+func (store *SQLiteStore) Bans() (records []*BanRecord, err error) {
+	rows, err := store.db.Query(`
+        SELECT mask, reason, set_by, set_time FROM server_ban`)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var mask, reason, setBy string
+		var setTime int64
+		if err = rows.Scan(&mask, &reason, &setBy, &setTime); err != nil {
+			return
+		}
+		records = append(records, &BanRecord{
+			mask:    NewName(mask),
+			reason:  NewText(reason),
+			setBy:   NewName(setBy),
+			setTime: fromUnixTime(setTime),
+		})
+	}
+	err = rows.Err()
+	return
+}
+
+func (store *SQLiteStore) SaveBan(record *BanRecord) error {
+	return store.inTransaction(func(tx *sql.Tx) error {
+		return saveBan(tx, record)
+	})
+}
+
+func saveBan(tx *sql.Tx, record *BanRecord) error {
+	_, err := tx.Exec(`
+        INSERT OR REPLACE INTO server_ban (mask, reason, set_by, set_time)
+          VALUES (?, ?, ?, ?)`,
+		record.mask.String(), record.reason.String(), record.setBy.String(),
+		unixTime(record.setTime))
+	return err
+}
+
+func (store *SQLiteStore) DeleteBan(mask Name) error {
+	_, err := store.db.Exec(`
+        DELETE FROM server_ban WHERE mask = ?`, mask.String())
+	return err
+}
+
+func (store *SQLiteStore) Import(channels []*ChannelRecord,
+	accounts []*AccountRecord, bans []*BanRecord) error {
+	return store.inTransaction(func(tx *sql.Tx) error {
+		for _, record := range channels {
+			if err := saveChannel(tx, record); err != nil {
+				return err
+			}
+		}
+		for _, record := range accounts {
+			if err := saveAccount(tx, record); err != nil {
+				return err
+			}
+		}
+		for _, record := range bans {
+			if err := saveBan(tx, record); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (store *SQLiteStore) WhoWas(limit int) (results []*WhoWas, err error) {
+	rows, err := store.db.Query(`
+        SELECT nickname, username, hostname, realname, ip, server_name,
+               sign_off_time
+          FROM whowas ORDER BY id DESC LIMIT ?`, limit)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var nickname, username, hostname, realname, ip, server string
+		var signOff int64
+		err = rows.Scan(&nickname, &username, &hostname, &realname, &ip, &server,
+			&signOff)
+		if err != nil {
+			return
+		}
+		results = append(results, &WhoWas{
+			hostname: NewName(hostname),
+			ip:       NewName(ip),
+			nickname: NewName(nickname),
+			realname: NewText(realname),
+			server:   NewName(server),
+			signOff:  fromUnixTime(signOff),
+			username: NewName(username),
+		})
+	}
+	err = rows.Err()
+	return
+}
+
+func (store *SQLiteStore) SaveWhoWas(entries []*WhoWas, keep int) error {
+	return store.inTransaction(func(tx *sql.Tx) error {
+		for _, whoWas := range entries {
+			_, err := tx.Exec(`
+                INSERT INTO whowas (nickname, username, hostname, realname, ip,
+                                    server_name, sign_off_time)
+                  VALUES (?, ?, ?, ?, ?, ?, ?)`,
+				whoWas.nickname.String(), whoWas.username.String(),
+				whoWas.hostname.String(), whoWas.realname.String(),
+				whoWas.ip.String(), whoWas.server.String(),
+				unixTime(whoWas.signOff))
+			if err != nil {
+				return err
+			}
+		}
+		_, err := tx.Exec(`
+            DELETE FROM whowas WHERE id NOT IN
+              (SELECT id FROM whowas ORDER BY id DESC LIMIT ?)`, keep)
+		return err
+	})
+}
+
+func (store *SQLiteStore) Close() error {
+	return store.db.Close()
+}
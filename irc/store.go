@@ -0,0 +1,137 @@
+package irc
+
+import (
+	"time"
+)
+
+// Store keeps server state that outlives a process: persistent channels,
+// accounts, server bans and nickname history. Store methods may be called
+// from any goroutine.
+type Store interface {
+	Channels() ([]*ChannelRecord, error)
+	SaveChannel(*ChannelRecord) error
+	DeleteChannel(name Name) error
+	// UpdateChannels saves and deletes channels all at once.
+	UpdateChannels(saves []*ChannelRecord, deletes []Name) error
+
+	Accounts() ([]*AccountRecord, error)
+	// Account returns nil if there is no account called `name`.
+	Account(name Name) (*AccountRecord, error)
+	SaveAccount(*AccountRecord) error
+	DeleteAccount(name Name) error
+
+	Bans() ([]*BanRecord, error)
+	SaveBan(*BanRecord) error
+	DeleteBan(mask Name) error
+
+	// WhoWas returns up to `limit` entries, newest first.
+	WhoWas(limit int) ([]*WhoWas, error)
+	// SaveWhoWas adds entries, oldest first, and then forgets all but the
+	// newest `keep`.
+	SaveWhoWas(entries []*WhoWas, keep int) error
+
+	// Import saves channels, accounts and bans all at once.
+	Import(channels []*ChannelRecord, accounts []*AccountRecord,
+		bans []*BanRecord) error
+
+	Close() error
+}
+
+// OpenStore opens the sqlite database at `path`, or an empty in-memory
+// store if `path` is ":memory:".
+func OpenStore(path string) Store {
+	if path == MEMORY_STORE {
+		return NewMemoryStore()
+	}
+	return NewSQLiteStore(path)
+}
+
+const (
+	MEMORY_STORE = ":memory:"
+)
+
+// ChannelRecord is the stored form of a persistent channel.
+type ChannelRecord struct {
+	ctime        time.Time
+	flags        ChannelModes
+	forward      Name
+	joinThrottle string
+	key          Text
+	masks        map[ChannelMode][]*UserMask
+	name         Name
+	topic        Text
+	topicSetBy   Name
+	topicTime    time.Time
+	userLimit    uint64
+}
+
+type AccountRecord struct {
+	ctime        time.Time
+	name         Name
+	passwordHash []byte
+}
+
+// BanRecord is a server ban, like the ones in the [ban] config sections.
+type BanRecord struct {
+	mask    Name
+	reason  Text
+	setBy   Name
+	setTime time.Time
+}
+
+// Record is the stored form of the channel.
+func (channel *Channel) Record() *ChannelRecord {
+	record := &ChannelRecord{
+		ctime:      channel.ctime,
+		flags:      make(ChannelModes, 0, len(channel.flags)),
+		forward:    channel.forward,
+		key:        channel.key,
+		masks:      make(map[ChannelMode][]*UserMask),
+		name:       channel.name,
+		topic:      channel.topic,
+		topicSetBy: channel.topicSetBy,
+		topicTime:  channel.topicTime,
+		userLimit:  channel.userLimit,
+	}
+	for mode := range channel.flags {
+		record.flags = append(record.flags, mode)
+	}
+	if channel.joinThrottle != nil {
+		record.joinThrottle = channel.joinThrottle.String()
+	}
+	for mode, list := range channel.lists {
+		for _, mask := range list.masks {
+			record.masks[mode] = append(record.masks[mode], mask)
+		}
+	}
+	return record
+}
+
+// NewChannelFromRecord recreates a stored channel.
+func NewChannelFromRecord(server *Server, record *ChannelRecord) *Channel {
+	channel := NewChannel(server, record.name)
+	for _, mode := range record.flags {
+		// flags stored by a server that supported more modes are dropped
+		if spec := LookupChannelMode(mode); (spec != nil) && (spec.kind == ChannelModeFlag) {
+			channel.flags[mode] = true
+		}
+	}
+	channel.key = record.key
+	channel.topic = record.topic
+	channel.topicSetBy = record.topicSetBy
+	channel.topicTime = record.topicTime
+	if !record.ctime.IsZero() {
+		channel.ctime = record.ctime
+	}
+	channel.userLimit = record.userLimit
+	if record.joinThrottle != "" {
+		channel.joinThrottle, _ = ParseThrottle(record.joinThrottle)
+	}
+	channel.forward = record.forward
+	for mode, masks := range record.masks {
+		if list := channel.lists[mode]; list != nil {
+			list.Load(masks)
+		}
+	}
+	return channel
+}
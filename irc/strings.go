@@ -4,12 +4,14 @@ import (
 	"code.google.com/p/go.text/unicode/norm"
 	"regexp"
 	"strings"
+	"unicode/utf8"
 )
 
 var (
-	// regexps
-	ChannelNameExpr = regexp.MustCompile(`^[&!#+][\pL\pN]{1,63}$`)
-	NicknameExpr    = regexp.MustCompile("^[\\pL\\pN\\pP\\pS]{1,32}$")
+	// regexps; lengths are checked against the configured Limits
+	ChannelNameExpr = regexp.MustCompile(`^[&!#+][\pL\pN]+$`)
+	ChannelMaskExpr = regexp.MustCompile(`^[&!#+][\pL\pN*?]+$`)
+	NicknameExpr    = regexp.MustCompile("^[\\pL\\pN\\pP\\pS]+$")
 )
 
 // Names are normalized and canonicalized to remove formatting marks
@@ -31,11 +33,20 @@ func NewNames(strs []string) []Name {
 // tests
 
 func (name Name) IsChannel() bool {
-	return ChannelNameExpr.MatchString(name.String())
+	return (name.Length() <= limits.ChannelLen) &&
+		ChannelNameExpr.MatchString(name.String())
+}
+
+// IsChannelMask is true for channel names that may contain wildcards.
+func (name Name) IsChannelMask() bool {
+	return (name.Length() <= limits.ChannelLen) &&
+		ChannelMaskExpr.MatchString(name.String())
 }
 
 func (name Name) IsNickname() bool {
-	return NicknameExpr.MatchString(name.String())
+	return (name.Length() <= limits.NickLen) &&
+		NicknameExpr.MatchString(name.String()) &&
+		casemapping.Allows(name.String())
 }
 
 // conversions
@@ -44,8 +55,27 @@ func (name Name) String() string {
 	return string(name)
 }
 
+// ToLower folds the name with the server's casemapping, for comparing
+// nicks, channel names and masks.
 func (name Name) ToLower() Name {
-	return Name(strings.ToLower(name.String()))
+	return Name(casemapping.Fold(name.String()))
+}
+
+// Truncate shortens the name to at most `length` bytes.
+// Length counts characters, which is how name limits are measured.
+func (name Name) Length() int {
+	return utf8.RuneCountInString(name.String())
+}
+
+// Truncate shortens the name to at most `length` characters.
+func (name Name) Truncate(length int) Name {
+	for index := range name.String() {
+		if length == 0 {
+			return name[:index]
+		}
+		length -= 1
+	}
+	return name
 }
 
 // It's safe to coerce a Name to Text. Name is a strict subset of Text.
@@ -65,6 +95,25 @@ func (text Text) String() string {
 	return string(text)
 }
 
+// Truncate shortens the text to at most `length` bytes.
+func (text Text) Truncate(length int) Text {
+	return Text(truncateUTF8(text.String(), length))
+}
+
+// HasColors is true if the text contains mIRC color codes.
+func (text Text) HasColors() bool {
+	return strings.ContainsAny(text.String(), "\x03\x04")
+}
+
+// IsCTCP is true for CTCP messages. If `allowAction` is set, ACTIONs
+// aren't counted.
+func (text Text) IsCTCP(allowAction bool) bool {
+	if !strings.HasPrefix(text.String(), "\x01") {
+		return false
+	}
+	return !(allowAction && strings.HasPrefix(text.String(), "\x01ACTION "))
+}
+
 // CTCPText is text suitably escaped for CTCP.
 type CTCPText string
 
@@ -77,9 +77,11 @@ func (m *TheaterPrivMsgCommand) HandleServer(s *Server) {
 		return
 	}
 
-	reply := RplPrivMsg(TheaterClient(m.asNick), channel, m.message)
+	replies := RplPrivMsgs(TheaterClient(m.asNick), channel, m.message)
 	for member := range channel.members {
-		member.Reply(reply)
+		for _, reply := range replies {
+			member.Reply(reply)
+		}
 	}
 }
 
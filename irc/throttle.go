@@ -0,0 +1,64 @@
+package irc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Throttle allows at most `count` events in any `period`.
+type Throttle struct {
+	count  uint64
+	period time.Duration
+	times  []time.Time
+}
+
+func NewThrottle(count uint64, period time.Duration) *Throttle {
+	return &Throttle{
+		count:  count,
+		period: period,
+	}
+}
+
+// ParseThrottle parses the `+j` argument, `<count>:<seconds>`.
+func ParseThrottle(arg string) (*Throttle, error) {
+	parts := strings.SplitN(arg, ":", 2)
+	if len(parts) != 2 {
+		return nil, ErrParseCommand
+	}
+	count, err := strconv.ParseUint(parts[0], 10, 32)
+	if (err != nil) || (count == 0) {
+		return nil, ErrParseCommand
+	}
+	seconds, err := strconv.ParseUint(parts[1], 10, 32)
+	if (err != nil) || (seconds == 0) {
+		return nil, ErrParseCommand
+	}
+	return NewThrottle(count, time.Duration(seconds)*time.Second), nil
+}
+
+func (throttle *Throttle) String() string {
+	return fmt.Sprintf("%d:%d", throttle.count, throttle.period/time.Second)
+}
+
+func (throttle *Throttle) expire(now time.Time) {
+	cutoff := now.Add(-throttle.period)
+	index := 0
+	for index < len(throttle.times) && !throttle.times[index].After(cutoff) {
+		index += 1
+	}
+	throttle.times = throttle.times[index:]
+}
+
+// Allow is true if another event may happen at `now`.
+func (throttle *Throttle) Allow(now time.Time) bool {
+	throttle.expire(now)
+	return uint64(len(throttle.times)) < throttle.count
+}
+
+// Record counts an event that happened at `now`.
+func (throttle *Throttle) Record(now time.Time) {
+	throttle.expire(now)
+	throttle.times = append(throttle.times, now)
+}
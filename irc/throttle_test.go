@@ -0,0 +1,80 @@
+package irc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseThrottle(t *testing.T) {
+	tests := []struct {
+		arg    string
+		count  uint64
+		period time.Duration
+	}{
+		{"5:10", 5, 10 * time.Second},
+		{"1:1", 1, time.Second},
+		{"3:600", 3, 10 * time.Minute},
+		// invalid
+		{"", 0, 0},
+		{"5", 0, 0},
+		{"5:", 0, 0},
+		{":10", 0, 0},
+		{"0:10", 0, 0},
+		{"5:0", 0, 0},
+		{"-1:10", 0, 0},
+		{"5:1.5", 0, 0},
+		{"5:10:15", 0, 0},
+		{"x:y", 0, 0},
+	}
+	for _, test := range tests {
+		throttle, err := ParseThrottle(test.arg)
+		if test.count == 0 {
+			if err == nil {
+				t.Errorf("ParseThrottle(%q) = %s, want an error", test.arg, throttle)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseThrottle(%q): %s", test.arg, err)
+			continue
+		}
+		if (throttle.count != test.count) || (throttle.period != test.period) {
+			t.Errorf("ParseThrottle(%q) = %d in %s", test.arg, throttle.count, throttle.period)
+		}
+		if throttle.String() != test.arg {
+			t.Errorf("ParseThrottle(%q).String() = %q", test.arg, throttle)
+		}
+	}
+}
+
+func TestThrottleAllow(t *testing.T) {
+	throttle := NewThrottle(2, 10*time.Second)
+	start := time.Now()
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+
+	steps := []struct {
+		seconds int
+		allow   bool
+	}{
+		{0, true},
+		{1, true},
+		{2, false},
+		{9, false},
+		// the first event expires exactly one period later
+		{10, true},
+		{11, true},
+		{12, false},
+		{30, true},
+	}
+	for _, step := range steps {
+		now := at(step.seconds)
+		if allow := throttle.Allow(now); allow != step.allow {
+			t.Fatalf("Allow at %ds = %t, want %t", step.seconds, allow, step.allow)
+		}
+		if step.allow {
+			throttle.Record(now)
+		}
+	}
+}
@@ -46,6 +46,31 @@ func (set ChannelModeSet) String() string {
 	return strings.Join(strs, "")
 }
 
+// Rank is the rank of the highest membership mode in the set.
+func (set ChannelModeSet) Rank() (rank int) {
+	for _, mode := range ChannelMemberModes {
+		if set[mode] {
+			return mode.Rank()
+		}
+	}
+	return
+}
+
+// Prefixes are the membership prefixes shown before a nick. Without
+// multi-prefix, only the highest is shown.
+func (set ChannelModeSet) Prefixes(isMultiPrefix bool) (prefixes string) {
+	for _, mode := range ChannelMemberModes {
+		if !set[mode] {
+			continue
+		}
+		prefixes += mode.Prefix()
+		if !isMultiPrefix {
+			break
+		}
+	}
+	return
+}
+
 type ClientSet map[*Client]bool
 
 func (clients ClientSet) Add(client *Client) {
@@ -83,6 +108,12 @@ func (members MemberSet) HasMode(member *Client, mode ChannelMode) bool {
 	return modes[mode]
 }
 
+// Rank is the rank of a member's highest membership mode, or 0 if it has
+// none or isn't a member.
+func (members MemberSet) Rank(member *Client) int {
+	return members[member].Rank()
+}
+
 func (members MemberSet) AnyHasMode(mode ChannelMode) bool {
 	for _, modes := range members {
 		if modes[mode] {
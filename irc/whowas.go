@@ -1,5 +1,13 @@
 package irc
 
+import (
+	"time"
+)
+
+const (
+	WHOWAS_DEFAULT_SIZE = 100
+)
+
 type WhoWasList struct {
 	buffer []*WhoWas
 	start  int
@@ -7,39 +15,68 @@ type WhoWasList struct {
 }
 
 type WhoWas struct {
-	nickname Name
-	username Name
 	hostname Name
+	ip       Name
+	nickname Name
 	realname Text
+	server   Name
+	signOff  time.Time
+	username Name
 }
 
 func NewWhoWasList(size uint) *WhoWasList {
+	if size == 0 {
+		size = WHOWAS_DEFAULT_SIZE
+	}
 	return &WhoWasList{
-		buffer: make([]*WhoWas, size),
+		// One slot is always empty, to tell a full buffer from an empty one.
+		buffer: make([]*WhoWas, size+1),
 	}
 }
 
-func (list *WhoWasList) Append(client *Client) {
-	list.buffer[list.end] = &WhoWas{
-		nickname: client.Nick(),
-		username: client.username,
+// Size is the most entries the list holds.
+func (list *WhoWasList) Size() int {
+	return len(list.buffer) - 1
+}
+
+func NewWhoWas(client *Client) *WhoWas {
+	return &WhoWas{
 		hostname: client.hostname,
+		ip:       client.ip,
+		nickname: client.Nick(),
 		realname: client.realname,
+		server:   client.server.name,
+		signOff:  time.Now(),
+		username: client.username,
 	}
+}
+
+func (list *WhoWasList) Append(whoWas *WhoWas) {
+	list.buffer[list.end] = whoWas
 	list.end = (list.end + 1) % len(list.buffer)
 	if list.end == list.start {
 		list.start = (list.end + 1) % len(list.buffer)
 	}
 }
 
-func (list *WhoWasList) Find(nickname Name, limit int64) []*WhoWas {
+// Find returns up to `limit` entries for nicknames matching `mask`, which
+// may contain wildcards, newest first. A `limit` of 0 or less means no
+// limit.
+func (list *WhoWasList) Find(mask Name, limit int64) []*WhoWas {
+	mask = mask.ToLower()
+	hasWildcards := HasWildcards(mask.String())
 	results := make([]*WhoWas, 0)
-	for whoWas := range list.Each() {
-		if nickname != whoWas.nickname {
+	for _, whoWas := range list.Each() {
+		nickname := whoWas.nickname.ToLower()
+		if hasWildcards {
+			if !MatchMask(mask, nickname) {
+				continue
+			}
+		} else if mask != nickname {
 			continue
 		}
 		results = append(results, whoWas)
-		if int64(len(results)) >= limit {
+		if (limit > 0) && (int64(len(results)) >= limit) {
 			break
 		}
 	}
@@ -54,20 +91,17 @@ func (list *WhoWasList) prev(index int) int {
 	return index
 }
 
-// Iterate the buffer in reverse.
-func (list *WhoWasList) Each() <-chan *WhoWas {
-	ch := make(chan *WhoWas)
-	go func() {
-		defer close(ch)
-		if list.start == list.end {
-			return
-		}
-		start := list.prev(list.end)
-		end := list.prev(list.start)
-		for start != end {
-			ch <- list.buffer[start]
-			start = list.prev(start)
-		}
-	}()
-	return ch
+// Each returns the entries newest first.
+func (list *WhoWasList) Each() []*WhoWas {
+	entries := make([]*WhoWas, 0, len(list.buffer))
+	if list.start == list.end {
+		return entries
+	}
+	start := list.prev(list.end)
+	end := list.prev(list.start)
+	for start != end {
+		entries = append(entries, list.buffer[start])
+		start = list.prev(start)
+	}
+	return entries
 }